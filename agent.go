@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"socialbot/config"
+	"socialbot/llm"
+	"socialbot/tools"
+)
+
+// DefaultQuestion is what agent mode answers when no question is given.
+const DefaultQuestion = "Who should I reach out to this week, and why?"
+
+// maxAgentRange is the longest span of calendar the model may list at once.
+const maxAgentRange = 366 * 24 * time.Hour
+
+// maxAgentDays is the furthest back the model may search mail.
+const maxAgentDays = 365
+
+// RunAgent lets the LLM answer question by calling tools to look up mail,
+// calendar events and feeds itself, instead of being handed a fixed slice
+// of history. It fails if the LLM is still calling tools after s.steps
+// rounds of calls.
+func (s *SocialAssistant) RunAgent(question string) (string, error) {
+	model, err := s.model()
+	if err != nil {
+		return "", err
+	}
+	agent, ok := model.(llm.Agent)
+	if !ok {
+		return "", fmt.Errorf("LLM provider %s does not support function calling", model.Name())
+	}
+
+	agentTools := s.agentTools()
+	if s.verbose {
+		for i := range agentTools {
+			agentTools[i].Call = s.transcribe(agentTools[i].Name, agentTools[i].Call)
+		}
+	}
+
+	prompt := formatAgentPrompt(s.contacts.Contacts(), s.now(), question)
+	s.logPrompt(model, prompt)
+	return agent.RunTools(s.ctx, prompt, agentTools, s.steps)
+}
+
+// transcribe wraps a tool so each call and its result are printed.
+func (s *SocialAssistant) transcribe(name string, call func(context.Context, json.RawMessage) (interface{}, error)) func(context.Context, json.RawMessage) (interface{}, error) {
+	return func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		fmt.Fprintf(s.out, "-> %s %s\n", name, args)
+		result, err := call(ctx, args)
+		if err != nil {
+			fmt.Fprintf(s.out, "<- %s failed: %v\n", name, err)
+			return result, err
+		}
+		data, _ := json.Marshal(result)
+		fmt.Fprintf(s.out, "<- %s\n", truncate(string(data), 200))
+		return result, nil
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func (s *SocialAssistant) agentTools() []llm.Tool {
+	return []llm.Tool{
+		{
+			Name:        "search_mail",
+			Description: "Summarize my email with one of my contacts: how many messages each way, when, and whether I owe them a reply.",
+			Parameters: &llm.Schema{
+				Type: "object",
+				Properties: map[string]*llm.Schema{
+					"email": {Type: "string", Description: "The contact's email address"},
+					"days":  {Type: "integer", Description: "How many days back to search, at most 365; defaults to the configured history window"},
+				},
+				Required: []string{"email"},
+			},
+			Call: s.searchMail,
+		},
+		{
+			Name:        "list_events",
+			Description: "List my calendar events starting in a date range, past or future, with their attendees.",
+			Parameters: &llm.Schema{
+				Type: "object",
+				Properties: map[string]*llm.Schema{
+					"from": {Type: "string", Description: "First day of the range, as YYYY-MM-DD"},
+					"to":   {Type: "string", Description: "Last day of the range, as YYYY-MM-DD"},
+				},
+				Required: []string{"from", "to"},
+			},
+			Call: s.listEvents,
+		},
+		{
+			Name:        "fetch_feed",
+			Description: "Fetch the latest posts from a contact's blog feed.",
+			Parameters: &llm.Schema{
+				Type: "object",
+				Properties: map[string]*llm.Schema{
+					"email": {Type: "string", Description: "The contact's email address"},
+				},
+				Required: []string{"email"},
+			},
+			Call: s.fetchFeed,
+		},
+	}
+}
+
+type mailSummary struct {
+	Contact       string `json:"contact"`
+	Days          int    `json:"days"`
+	Emails        int    `json:"emails"`
+	Received      int    `json:"received"`
+	Sent          int    `json:"sent"`
+	LastReceived  string `json:"last_received"`
+	LastSent      string `json:"last_sent"`
+	AwaitingReply bool   `json:"awaiting_my_reply"`
+}
+
+func (s *SocialAssistant) searchMail(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	var params struct {
+		Email string `json:"email"`
+		Days  int    `json:"days"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+	contact := s.findContact(params.Email)
+	if contact == nil {
+		return nil, fmt.Errorf("%s is not one of my contacts", params.Email)
+	}
+	if params.Days <= 0 {
+		params.Days = s.days
+	}
+	if params.Days > maxAgentDays {
+		return nil, fmt.Errorf("days must be at most %d", maxAgentDays)
+	}
+
+	interactions, err := s.mailSource().GetInteractionsByParticipant(ctx, contact.Email, s.now().AddDate(0, 0, -params.Days))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email interactions: %v", err)
+	}
+	summary := mailSummary{Contact: contact.Email, Days: params.Days, LastReceived: "never", LastSent: "never"}
+	for _, interaction := range interactions {
+		if interaction.Participant == contact.Email {
+			summary.Emails = interaction.Count
+			summary.Received = interaction.ReceivedCount
+			summary.Sent = interaction.SentCount
+			summary.LastReceived = formatDate(interaction.LastReceived)
+			summary.LastSent = formatDate(interaction.LastSent)
+			summary.AwaitingReply = interaction.AwaitingReply()
+		}
+	}
+	return summary, nil
+}
+
+type eventSummary struct {
+	Title     string   `json:"title"`
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	AllDay    bool     `json:"all_day,omitempty"`
+	Attendees []string `json:"attendees,omitempty"`
+}
+
+func (s *SocialAssistant) listEvents(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	var params struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+	now := s.now()
+	from, err := time.ParseInLocation("2006-01-02", params.From, now.Location())
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date: %v", err)
+	}
+	to, err := time.ParseInLocation("2006-01-02", params.To, now.Location())
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date: %v", err)
+	}
+	to = to.AddDate(0, 0, 1)
+	if !to.After(from) || to.Sub(from) > maxAgentRange {
+		return nil, fmt.Errorf("the range must run forwards and cover at most a year")
+	}
+
+	var events []tools.Event
+	if from.Before(now) {
+		past, err := s.calendarSource().GetRecentEvents(ctx, from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get calendar events: %v", err)
+		}
+		events = append(events, past...)
+	}
+	if to.After(now) {
+		upcoming, err := s.calendarSource().GetUpcomingEvents(ctx, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get upcoming calendar events: %v", err)
+		}
+		events = append(events, upcoming...)
+	}
+
+	result := []eventSummary{}
+	for _, event := range events {
+		if event.StartTime.Before(from) || !event.StartTime.Before(to) {
+			continue
+		}
+		summary := eventSummary{
+			Title:  event.Title,
+			Start:  event.StartTime.Format(time.RFC3339),
+			End:    event.EndTime.Format(time.RFC3339),
+			AllDay: event.AllDay,
+		}
+		for _, attendee := range event.Attendees {
+			if contact := s.contacts.Resolve(attendee); contact != nil {
+				attendee = fmt.Sprintf("%s (%s)", contact.Name, contact.Email)
+			}
+			summary.Attendees = append(summary.Attendees, attendee)
+		}
+		result = append(result, summary)
+	}
+	return result, nil
+}
+
+type postSummary struct {
+	Title     string `json:"title"`
+	Link      string `json:"link"`
+	Published string `json:"published"`
+}
+
+func (s *SocialAssistant) fetchFeed(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	var params struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+	contact := s.findContact(params.Email)
+	if contact == nil {
+		return nil, fmt.Errorf("%s is not one of my contacts", params.Email)
+	}
+	if contact.RSSFeed == "" {
+		return nil, fmt.Errorf("%s has no feed", contact.Email)
+	}
+
+	posts, err := s.feeds.GetRecentPosts(ctx, contact.RSSFeed, 5)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %v", err)
+	}
+	result := []postSummary{}
+	for _, post := range posts {
+		result = append(result, postSummary{Title: post.Title, Link: post.Link, Published: formatDate(post.Published)})
+	}
+	return result, nil
+}
+
+func formatAgentPrompt(contacts []config.Contact, now time.Time, question string) string {
+	return fmt.Sprintf(`You help me keep in touch with the people who matter to me. Today is %s.
+
+My important contacts:
+%v
+Use the tools to look up my email with them, my calendar and their blogs as you need to, then answer my question. Base the answer only on what the tools return.
+
+%s`, now.Format("Monday 2006-01-02"), formatContacts(contacts), question)
+}
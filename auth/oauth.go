@@ -14,33 +14,58 @@ import (
 	"google.golang.org/api/gmail/v1"
 )
 
-// GetClient creates a client with both Gmail and Calendar scopes
-func GetClient() (*http.Client, error) {
+// DefaultScopes are the Gmail and Calendar scopes every command needs.
+var DefaultScopes = []string{
+	gmail.GmailComposeScope,
+	gmail.GmailReadonlyScope,
+	calendar.CalendarReadonlyScope,
+}
+
+// GetClient creates a client with both Gmail and Calendar scopes, plus any
+// extra scopes a command needs. If the saved token was not granted every
+// requested scope, the user is asked to authorize again.
+func GetClient(extraScopes ...string) (*http.Client, error) {
 	b, err := os.ReadFile("oauth_credentials.json")
 	if err != nil {
 		return nil, fmt.Errorf("unable to read client secret file: %v", err)
 	}
 
-	// Configure with both scopes
-	config, err := google.ConfigFromJSON(b,
-		gmail.GmailComposeScope,
-		gmail.GmailReadonlyScope,
-		calendar.CalendarReadonlyScope,
-	)
+	scopes := append(append([]string{}, DefaultScopes...), extraScopes...)
+	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
 	}
 
 	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
-	if err != nil {
+	tok, granted, err := tokenFromFile(tokFile)
+	if err != nil || !hasScopes(granted, scopes) {
 		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+		saveToken(tokFile, tok, scopes)
 	}
 
 	return config.Client(context.Background(), tok), nil
 }
 
+// savedToken is the token file format. Scopes records what the token was
+// granted; tokens saved before it was added have the default scopes.
+type savedToken struct {
+	*oauth2.Token
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+func hasScopes(granted, wanted []string) bool {
+	have := make(map[string]bool)
+	for _, scope := range granted {
+		have[scope] = true
+	}
+	for _, scope := range wanted {
+		if !have[scope] {
+			return false
+		}
+	}
+	return true
+}
+
 func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
 	fmt.Printf("Go to the following link in your browser: \n%v\n", authURL)
@@ -58,22 +83,27 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 	return tok
 }
 
-func tokenFromFile(file string) (*oauth2.Token, error) {
+func tokenFromFile(file string) (*oauth2.Token, []string, error) {
 	f, err := os.Open(file)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+	tok := savedToken{Token: &oauth2.Token{}}
+	if err := json.NewDecoder(f).Decode(&tok); err != nil {
+		return nil, nil, err
+	}
+	if len(tok.Scopes) == 0 {
+		tok.Scopes = DefaultScopes
+	}
+	return tok.Token, tok.Scopes, nil
 }
 
-func saveToken(path string, token *oauth2.Token) {
+func saveToken(path string, token *oauth2.Token, scopes []string) {
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		glog.Exitf("Unable to cache oauth token: %v", err)
 	}
 	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	json.NewEncoder(f).Encode(savedToken{Token: token, Scopes: scopes})
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"socialbot/config"
+	"socialbot/llm"
+
+	"github.com/golang/glog"
+)
+
+const chatHelp = `Commands:
+  /recommend       who to reach out to this week
+  /draft EMAIL     draft an email to a contact
+  /catchup EMAIL   summarize a contact's recent blog posts
+  /contacts        list my important contacts
+  /help            show this help
+  /quit            leave the chat`
+
+// ChatLoop holds an interactive conversation with the LLM until the input
+// ends or I type /quit. The conversation starts out knowing my contacts and
+// recent interactions with them, and the results of slash commands are
+// added to it so I can ask about them.
+func (s *SocialAssistant) ChatLoop() error {
+	model, err := s.model()
+	if err != nil {
+		return err
+	}
+	chatter, ok := model.(llm.Chatter)
+	if !ok {
+		return fmt.Errorf("LLM provider %s does not support chat", model.Name())
+	}
+
+	history, err := s.loadHistory(s.days)
+	if err != nil {
+		return err
+	}
+	everyone := make(map[string]bool)
+	for _, contact := range s.contacts.Contacts() {
+		everyone[contact.Email] = true
+	}
+	system := formatChatContext(s.contacts.Contacts(), history, s.withContacts(history.Upcoming, everyone), s.now(), s.days, s.ahead)
+	glog.Infof("Starting chat with %s:\n%s", model.Name(), system)
+	conversation := chatter.StartChat(system)
+
+	fmt.Fprintln(s.out, "Ask me about your contacts. Type /help for commands or /quit to leave.")
+	reader := &chatReader{in: s.in}
+	for {
+		fmt.Fprint(s.out, "\n> ")
+		// Ctrl-C at the prompt must not end the program; during a turn
+		// chatTurn handles it instead.
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		input, ok := reader.next(interrupts)
+		signal.Stop(interrupts)
+		if !ok {
+			fmt.Fprintln(s.out, "\nType /quit to leave.")
+			continue
+		}
+
+		line, err := strings.TrimSpace(input.line), input.err
+		if line == "" {
+			if err != nil {
+				return nil
+			}
+			continue
+		}
+		if line == "/quit" || line == "/exit" {
+			return nil
+		}
+
+		if err := s.chatTurn(conversation, line); err != nil {
+			fmt.Fprintf(s.out, "Error: %v\n", err)
+		}
+	}
+}
+
+// chatReader reads chat input in the background so that waiting for a line
+// can be interrupted without losing it.
+type chatReader struct {
+	in      *bufio.Reader
+	pending chan chatInput
+}
+
+type chatInput struct {
+	line string
+	err  error
+}
+
+// next returns the next line of input, or false if interrupt fires first.
+// The read carries on, and its line is returned by the following call.
+func (r *chatReader) next(interrupt <-chan os.Signal) (chatInput, bool) {
+	if r.pending == nil {
+		pending := make(chan chatInput, 1)
+		go func() {
+			line, err := r.in.ReadString('\n')
+			pending <- chatInput{line, err}
+		}()
+		r.pending = pending
+	}
+
+	select {
+	case input := <-r.pending:
+		r.pending = nil
+		return input, true
+	case <-interrupt:
+		return chatInput{}, false
+	}
+}
+
+// chatTurn sends line to the conversation and shows the reply. Ctrl-C
+// cancels the turn without ending the chat.
+func (s *SocialAssistant) chatTurn(conversation llm.Conversation, line string) error {
+	ctx := s.ctx
+	defer func() { s.ctx = ctx }()
+	var stop context.CancelFunc
+	s.ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	if strings.HasPrefix(line, "/") {
+		result, err := s.chatCommand(conversation, line)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, result)
+		return nil
+	}
+
+	if s.stream == nil {
+		reply, err := conversation.Send(s.ctx, line)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, reply)
+		return nil
+	}
+	_, err := conversation.SendStream(s.ctx, line, func(text string) {
+		fmt.Fprint(s.stream, text)
+	})
+	fmt.Fprintln(s.stream)
+	return err
+}
+
+// chatCommand runs a slash command and adds its result to the conversation.
+// Its output is shown once it is complete rather than streamed.
+func (s *SocialAssistant) chatCommand(conversation llm.Conversation, line string) (string, error) {
+	stream := s.stream
+	s.stream = nil
+	defer func() { s.stream = stream }()
+
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	var result string
+	var err error
+	switch command {
+	case "/help":
+		return chatHelp, nil
+	case "/contacts":
+		result = formatContacts(s.contacts.Contacts())
+	case "/recommend":
+		var recommendations []Recommendation
+		if recommendations, err = s.GetSocialRecommendations(); err == nil {
+			result = formatRecommendations(recommendations)
+		}
+	case "/draft":
+		if arg == "" {
+			return "", fmt.Errorf("usage: /draft EMAIL")
+		}
+		result, err = s.DraftEmail(arg, DraftOptions{})
+	case "/catchup":
+		if arg == "" {
+			return "", fmt.Errorf("usage: /catchup EMAIL")
+		}
+		result, err = s.CatchupWithBlog(arg)
+	default:
+		return "", fmt.Errorf("unknown command %s (type /help for commands)", command)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	conversation.Note(fmt.Sprintf("I ran %s and got:", line), result)
+	return result, nil
+}
+
+func formatChatContext(contacts []config.Contact, history *socialHistory, upcoming []contactEvent, now time.Time, days, ahead int) string {
+	return fmt.Sprintf(`You help me keep in touch with the people who matter to me. Today is %s.
+
+My important contacts:
+%v
+Important Contact Interactions (Last %d days):
+%v
+Upcoming Events with Important Contacts (Next %d days):
+%v
+Answer my questions using this context. I can also run commands such as /recommend, /draft and /catchup; their results will appear in our conversation.`,
+		now.Format("Monday 2006-01-02"), formatContacts(contacts), days, formatInteractions(history.Interactions), ahead, formatUpcomingEvents(upcoming))
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+var cadenceUnits = map[string]time.Duration{
+	"day":   day,
+	"week":  7 * day,
+	"month": 30 * day,
+	"year":  365 * day,
+}
+
+var namedCadences = map[string]time.Duration{
+	"daily":       day,
+	"weekly":      7 * day,
+	"biweekly":    14 * day,
+	"fortnightly": 14 * day,
+	"monthly":     30 * day,
+	"quarterly":   91 * day,
+	"yearly":      365 * day,
+	"annually":    365 * day,
+}
+
+// ParseCadence parses how often I want to be in touch with someone, such as
+// "weekly", "every 3 months" or "every other week".
+func ParseCadence(s string) (time.Duration, error) {
+	text := strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if d, ok := namedCadences[text]; ok {
+		return d, nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) < 2 || len(fields) > 3 || fields[0] != "every" {
+		return 0, fmt.Errorf("invalid cadence %q: want e.g. \"weekly\" or \"every 3 months\"", s)
+	}
+
+	count := 1
+	if len(fields) == 3 {
+		if fields[1] == "other" {
+			count = 2
+		} else {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid cadence %q: bad count %q", s, fields[1])
+			}
+			count = n
+		}
+	}
+
+	unit, ok := cadenceUnits[strings.TrimSuffix(fields[len(fields)-1], "s")]
+	if !ok {
+		return 0, fmt.Errorf("invalid cadence %q: unknown unit %q", s, fields[len(fields)-1])
+	}
+	return time.Duration(count) * unit, nil
+}
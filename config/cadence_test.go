@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCadence(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"weekly", 7 * day},
+		{"Monthly", 30 * day},
+		{"yearly", 365 * day},
+		{"every 3 months", 90 * day},
+		{"every  2 weeks", 14 * day},
+		{"every other week", 14 * day},
+		{"every day", day},
+		{"every 10 days", 10 * day},
+	}
+	for _, tt := range tests {
+		got, err := ParseCadence(tt.in)
+		if err != nil {
+			t.Errorf("ParseCadence(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCadence(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "sometimes", "every 0 weeks", "every 3 fortnights", "3 months"} {
+		if _, err := ParseCadence(in); err == nil {
+			t.Errorf("ParseCadence(%q) succeeded, want error", in)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 )
@@ -13,8 +14,14 @@ type Contact struct {
 	Email         string
 	Name          string
 	Priority      int
-	RSSFeed       string `json:"rss_feed,omitempty"`
-	WritingSample string `json:"writing_sample,omitempty"`
+	Aliases       []string `json:"aliases,omitempty"`
+	RSSFeed       string   `json:"rss_feed,omitempty"`
+	WritingSample string   `json:"writing_sample,omitempty"`
+	TimeZone      string   `json:"timezone,omitempty"`
+
+	// Cadence is how often I want to be in touch, such as "weekly" or
+	// "every 3 months". See ParseCadence.
+	Cadence string `json:"cadence,omitempty"`
 }
 
 func (c *Contact) validate() error {
@@ -30,10 +37,57 @@ func (c *Contact) validate() error {
 	if c.Priority < 1 || c.Priority > 5 {
 		return fmt.Errorf("priority must be between 1-5 for %s", c.Email)
 	}
+	for _, alias := range c.Aliases {
+		if !strings.Contains(alias, "@") {
+			return fmt.Errorf("invalid alias format for %s: %s", c.Email, alias)
+		}
+	}
+	if c.TimeZone != "" {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			return fmt.Errorf("invalid time zone for %s: %v", c.Email, err)
+		}
+	}
+	if c.Cadence != "" {
+		if _, err := ParseCadence(c.Cadence); err != nil {
+			return fmt.Errorf("invalid cadence for %s: %v", c.Email, err)
+		}
+	}
 	return nil
 }
 
-func GetImportantContacts() []Contact {
+// CadenceInterval returns the contact's parsed cadence, or false if none is
+// set.
+func (c *Contact) CadenceInterval() (time.Duration, bool) {
+	if c.Cadence == "" {
+		return 0, false
+	}
+	d, err := ParseCadence(c.Cadence)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+// Location returns the contact's time zone, defaulting to my own.
+func (c *Contact) Location() *time.Location {
+	if c.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Addresses returns the contact's primary email followed by its aliases.
+func (c *Contact) Addresses() []string {
+	return append([]string{c.Email}, c.Aliases...)
+}
+
+// GetImportantContacts reads config/contacts.json, exiting if it is invalid
+// or lists an address, as matched with opts, for more than one contact.
+func GetImportantContacts(opts AddressOptions) []Contact {
 	file, err := os.ReadFile("config/contacts.json")
 	if err != nil {
 		glog.Exitf("Failed to read contacts file: %v", err)
@@ -44,10 +98,18 @@ func GetImportantContacts() []Contact {
 		glog.Exitf("Failed to parse contacts: %v", err)
 	}
 
+	owners := make(map[string]string)
 	for _, contact := range contacts {
 		if err := contact.validate(); err != nil {
 			glog.Exitf("Invalid contact data: %v", err)
 		}
+		for _, address := range contact.Addresses() {
+			key := NormalizeAddress(address, opts)
+			if owner, ok := owners[key]; ok && owner != contact.Email {
+				glog.Exitf("Invalid contact data: %s is listed for both %s and %s", address, owner, contact.Email)
+			}
+			owners[key] = contact.Email
+		}
 	}
 
 	return contacts
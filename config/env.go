@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// EnvOr returns the value of the environment variable key, or fallback if it
+// is unset or empty.
+func EnvOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// SplitList splits a comma-separated flag or environment value, trimming
+// spaces and dropping empty entries.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"net/mail"
+	"os"
+	"strings"
+)
+
+// AddressOptions controls how loosely email addresses are matched to
+// contacts. Addresses are always parsed and case-folded.
+type AddressOptions struct {
+	// StripPlus drops "+tag" suffixes, so jane+news@example.com matches
+	// jane@example.com.
+	StripPlus bool
+	// GmailDots ignores dots in the local part of gmail.com and
+	// googlemail.com addresses, which Gmail itself ignores.
+	GmailDots bool
+}
+
+// AddressOptionsFromEnv returns the options turned on by setting
+// ADDRESS_STRIP_PLUS or ADDRESS_GMAIL_DOTS to "true". Both are off by
+// default.
+func AddressOptionsFromEnv() AddressOptions {
+	return AddressOptions{
+		StripPlus: os.Getenv("ADDRESS_STRIP_PLUS") == "true",
+		GmailDots: os.Getenv("ADDRESS_GMAIL_DOTS") == "true",
+	}
+}
+
+// NormalizeAddress reduces an address, with or without a display name, to
+// the canonical form used for matching.
+func NormalizeAddress(address string, opts AddressOptions) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	address = strings.ToLower(strings.TrimSpace(address))
+
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address
+	}
+	local, domain := address[:at], address[at+1:]
+
+	if opts.StripPlus {
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if opts.GmailDots && domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// Identities resolves email addresses to contacts through their primary
+// address and aliases.
+type Identities struct {
+	opts      AddressOptions
+	contacts  []Contact
+	byAddress map[string]int
+}
+
+func NewIdentities(contacts []Contact, opts AddressOptions) *Identities {
+	ids := &Identities{
+		opts:      opts,
+		contacts:  contacts,
+		byAddress: make(map[string]int),
+	}
+	for i, contact := range contacts {
+		for _, address := range contact.Addresses() {
+			key := NormalizeAddress(address, opts)
+			if _, exists := ids.byAddress[key]; !exists {
+				ids.byAddress[key] = i
+			}
+		}
+	}
+	return ids
+}
+
+// Contacts returns every contact in the index.
+func (ids *Identities) Contacts() []Contact {
+	return ids.contacts
+}
+
+// Normalize returns address in the form the index matches on.
+func (ids *Identities) Normalize(address string) string {
+	return NormalizeAddress(address, ids.opts)
+}
+
+// Resolve returns the contact an address belongs to, or nil.
+func (ids *Identities) Resolve(address string) *Contact {
+	if i, ok := ids.byAddress[NormalizeAddress(address, ids.opts)]; ok {
+		return &ids.contacts[i]
+	}
+	return nil
+}
+
+// Same reports whether two addresses belong to the same person: either they
+// normalize to the same address or they resolve to the same contact.
+func (ids *Identities) Same(a, b string) bool {
+	na, nb := NormalizeAddress(a, ids.opts), NormalizeAddress(b, ids.opts)
+	if na == nb {
+		return true
+	}
+	ia, okA := ids.byAddress[na]
+	ib, okB := ids.byAddress[nb]
+	return okA && okB && ia == ib
+}
+
+// AddressesFor returns every known address of the contact that address
+// belongs to, or just address if it is not a contact.
+func (ids *Identities) AddressesFor(address string) []string {
+	if contact := ids.Resolve(address); contact != nil {
+		return contact.Addresses()
+	}
+	return []string{address}
+}
@@ -0,0 +1,76 @@
+package config
+
+import "testing"
+
+// loose turns on both of the optional matching rules.
+var loose = AddressOptions{StripPlus: true, GmailDots: true}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		in   string
+		opts AddressOptions
+		want string
+	}{
+		{"Jane@Example.com", loose, "jane@example.com"},
+		{`"Doe, Jane" <Jane@Example.com>`, loose, "jane@example.com"},
+		{"jane+news@example.com", loose, "jane@example.com"},
+		{"jane+news@example.com", AddressOptions{}, "jane+news@example.com"},
+		{"J.Doe@gmail.com", loose, "jdoe@gmail.com"},
+		{"j.doe@googlemail.com", loose, "jdoe@gmail.com"},
+		{"j.doe@example.com", loose, "j.doe@example.com"},
+		{"J.Doe@gmail.com", AddressOptions{}, "j.doe@gmail.com"},
+		{"not an address", loose, "not an address"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeAddress(tt.in, tt.opts); got != tt.want {
+			t.Errorf("NormalizeAddress(%q, %+v) = %q, want %q", tt.in, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	ids := NewIdentities([]Contact{
+		{Email: "jane@example.com", Name: "Jane", Priority: 5, Aliases: []string{"jane.doe@work.example", "janedoe@gmail.com"}},
+		{Email: "bob@example.com", Name: "Bob", Priority: 3},
+	}, loose)
+
+	for _, address := range []string{
+		"jane@example.com",
+		"Jane@Example.com",
+		"Jane Doe <jane+news@example.com>",
+		"JANE.DOE@work.example",
+		"jane.doe@gmail.com",
+	} {
+		if contact := ids.Resolve(address); contact == nil || contact.Name != "Jane" {
+			t.Errorf("Resolve(%q) = %v, want Jane", address, contact)
+		}
+	}
+	if contact := ids.Resolve("stranger@example.com"); contact != nil {
+		t.Errorf("Resolve(stranger) = %v, want nil", contact)
+	}
+
+	if !ids.Same("jane.doe@work.example", "jane@example.com") {
+		t.Error("Same() = false for two of Jane's addresses")
+	}
+	if ids.Same("jane@example.com", "bob@example.com") {
+		t.Error("Same() = true for different contacts")
+	}
+	if !ids.Same("Stranger@Example.com", "stranger@example.com") {
+		t.Error("Same() = false for the same unknown address")
+	}
+}
+
+func TestAddressOptionsFromEnv(t *testing.T) {
+	t.Setenv("ADDRESS_STRIP_PLUS", "")
+	t.Setenv("ADDRESS_GMAIL_DOTS", "")
+	if opts := AddressOptionsFromEnv(); opts != (AddressOptions{}) {
+		t.Errorf("AddressOptionsFromEnv() = %+v, want both rules off by default", opts)
+	}
+
+	t.Setenv("ADDRESS_STRIP_PLUS", "true")
+	t.Setenv("ADDRESS_GMAIL_DOTS", "true")
+	if opts := AddressOptionsFromEnv(); opts != loose {
+		t.Errorf("AddressOptionsFromEnv() = %+v, want both rules on", opts)
+	}
+}
@@ -0,0 +1,62 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"socialbot/tools"
+)
+
+// Calendar is an in-memory tools.CalendarSource and tools.Scheduler backed
+// by canned events. Holds records every hold created.
+type Calendar struct {
+	Events []tools.Event
+	Now    time.Time
+	Holds  []tools.Hold
+}
+
+func (c *Calendar) GetRecentEvents(ctx context.Context, since time.Time) ([]tools.Event, error) {
+	return c.between(since, c.Now), nil
+}
+
+func (c *Calendar) GetUpcomingEvents(ctx context.Context, until time.Time) ([]tools.Event, error) {
+	return c.between(c.Now, until), nil
+}
+
+func (c *Calendar) between(from, to time.Time) []tools.Event {
+	var events []tools.Event
+	for _, event := range c.Events {
+		if event.StartTime.Before(from) || event.StartTime.After(to) {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartTime.Before(events[j].StartTime)
+	})
+	return events
+}
+
+// FreeBusy treats every timed event overlapping from..to as busy. All-day
+// events don't block time, as in Google Calendar.
+func (c *Calendar) FreeBusy(ctx context.Context, from, to time.Time) ([]tools.TimeRange, error) {
+	window := tools.TimeRange{Start: from, End: to}
+	var busy []tools.TimeRange
+	for _, event := range c.Events {
+		span := tools.TimeRange{Start: event.StartTime, End: event.EndTime}
+		if !event.AllDay && span.Overlaps(window) {
+			busy = append(busy, span)
+		}
+	}
+	sort.Slice(busy, func(i, j int) bool {
+		return busy[i].Start.Before(busy[j].Start)
+	})
+	return busy, nil
+}
+
+func (c *Calendar) CreateHold(ctx context.Context, hold tools.Hold) (string, error) {
+	c.Holds = append(c.Holds, hold)
+	return fmt.Sprintf("https://calendar.example.com/hold/%d", len(c.Holds)), nil
+}
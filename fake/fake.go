@@ -0,0 +1,16 @@
+// Package fake provides in-memory stand-ins for the Gmail, Calendar, feed and
+// LLM backends so the assistant can be exercised without network access.
+package fake
+
+import (
+	"socialbot/llm"
+	"socialbot/tools"
+)
+
+var (
+	_ tools.MailSource     = (*Mailbox)(nil)
+	_ tools.CalendarSource = (*Calendar)(nil)
+	_ tools.Scheduler      = (*Calendar)(nil)
+	_ tools.FeedSource     = (*Feeds)(nil)
+	_ llm.Provider         = (*LLM)(nil)
+)
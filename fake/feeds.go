@@ -0,0 +1,28 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+
+	"socialbot/tools"
+)
+
+// Feeds is an in-memory tools.FeedSource keyed by feed URL.
+type Feeds struct {
+	Posts map[string][]tools.BlogPost
+}
+
+func (f *Feeds) GetRecentPosts(ctx context.Context, feedURL string, limit int) ([]tools.BlogPost, error) {
+	if feedURL == "" {
+		return nil, nil
+	}
+
+	posts, ok := f.Posts[feedURL]
+	if !ok {
+		return nil, fmt.Errorf("failed to parse feed: %s not found", feedURL)
+	}
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
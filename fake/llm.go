@@ -0,0 +1,138 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"socialbot/llm"
+)
+
+// LLM is a scripted llm.Provider that replies with Responses in order and
+// records every prompt it receives.
+type LLM struct {
+	Responses []string
+	Prompts   []string
+
+	// Errors, where set, are returned instead of the response at the same
+	// index.
+	Errors []error
+
+	// ToolCalls are the rounds of calls RunTools makes before answering
+	// with the next response. ToolResults records each call's result as
+	// JSON.
+	ToolCalls   [][]ToolCall
+	ToolResults []string
+
+	// System is the instructions of the last conversation started, and
+	// History its messages and replies in order.
+	System  string
+	History []string
+}
+
+// ToolCall is a scripted call to the tool Name with JSON arguments Args.
+type ToolCall struct {
+	Name string
+	Args string
+}
+
+func (l *LLM) Name() string {
+	return "fake"
+}
+
+func (l *LLM) GenerateContent(ctx context.Context, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	l.Prompts = append(l.Prompts, prompt)
+	if len(l.Prompts) > len(l.Responses) {
+		return "", fmt.Errorf("failed to generate response: no scripted response for prompt %d", len(l.Prompts))
+	}
+	i := len(l.Prompts) - 1
+	if i < len(l.Errors) && l.Errors[i] != nil {
+		return "", l.Errors[i]
+	}
+	return l.Responses[i], nil
+}
+
+// GenerateJSON replies like GenerateContent; scripted responses for it
+// should be JSON.
+func (l *LLM) GenerateJSON(ctx context.Context, prompt string, schema *llm.Schema) (string, error) {
+	return l.GenerateContent(ctx, prompt)
+}
+
+func (l *LLM) RunTools(ctx context.Context, prompt string, tools []llm.Tool, maxSteps int) (string, error) {
+	for step, round := range l.ToolCalls {
+		if step == maxSteps {
+			return "", fmt.Errorf("model still calling tools after %d steps", maxSteps)
+		}
+		for _, call := range round {
+			result, err := json.Marshal(llm.CallTool(ctx, tools, call.Name, json.RawMessage(call.Args)))
+			if err != nil {
+				return "", err
+			}
+			l.ToolResults = append(l.ToolResults, string(result))
+		}
+	}
+	return l.GenerateContent(ctx, prompt)
+}
+
+// Stream replies like GenerateContent, passing the response to onText a
+// word at a time.
+func (l *LLM) Stream(ctx context.Context, prompt string, schema *llm.Schema, onText func(string)) (string, error) {
+	reply, err := l.GenerateContent(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	stream(reply, onText)
+	return reply, nil
+}
+
+func stream(reply string, onText func(string)) {
+	for _, chunk := range strings.SplitAfter(reply, " ") {
+		onText(chunk)
+	}
+}
+
+// StartChat returns a conversation that replies with the scripted
+// Responses, like GenerateContent.
+func (l *LLM) StartChat(system string) llm.Conversation {
+	l.System = system
+	l.History = nil
+	return &conversation{llm: l}
+}
+
+type conversation struct {
+	llm *LLM
+}
+
+func (c *conversation) Send(ctx context.Context, message string) (string, error) {
+	reply, err := c.llm.GenerateContent(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	c.Note(message, reply)
+	return reply, nil
+}
+
+func (c *conversation) SendStream(ctx context.Context, message string, onText func(string)) (string, error) {
+	reply, err := c.Send(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	stream(reply, onText)
+	return reply, nil
+}
+
+func (c *conversation) Note(message, reply string) {
+	c.llm.History = append(c.llm.History, message, reply)
+}
+
+func (l *LLM) CountTokens(ctx context.Context, prompt string) (int, error) {
+	return len(strings.Fields(prompt)), nil
+}
+
+func (l *LLM) Close() error {
+	return nil
+}
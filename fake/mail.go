@@ -0,0 +1,52 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"socialbot/config"
+	"socialbot/tools"
+)
+
+// Mailbox is an in-memory tools.MailSource backed by canned messages.
+type Mailbox struct {
+	// Identities matches message addresses to contacts.
+	Identities *config.Identities
+	Messages   []tools.Message
+	Now        time.Time
+
+	// Threads holds the latest conversation with each participant.
+	Threads map[string]tools.Thread
+
+	// Drafts records every draft passed to SaveDraft.
+	Drafts []tools.DraftEmail
+}
+
+func (m *Mailbox) GetRecentInteractions(ctx context.Context, since time.Time, query string) ([]tools.EmailInteraction, error) {
+	return tools.SummarizeInteractions(m.since(since, ""), m.Identities), nil
+}
+
+func (m *Mailbox) GetInteractionsByParticipant(ctx context.Context, participant string, since time.Time) ([]tools.EmailInteraction, error) {
+	return tools.SummarizeInteractions(m.since(since, participant), m.Identities), nil
+}
+
+func (m *Mailbox) GetLatestThread(ctx context.Context, participant string) (*tools.Thread, error) {
+	thread, ok := m.Threads[participant]
+	if !ok {
+		return nil, nil
+	}
+	return &thread, nil
+}
+
+func (m *Mailbox) SaveDraft(ctx context.Context, draft tools.DraftEmail) error {
+	if draft.To == "" {
+		return fmt.Errorf("failed to create draft: no recipient")
+	}
+	m.Drafts = append(m.Drafts, draft)
+	return nil
+}
+
+func (m *Mailbox) since(since time.Time, participant string) []tools.Message {
+	return tools.FilterMessages(m.Messages, since, participant, m.Identities)
+}
@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Tool is a function the model may call while working out its answer.
+type Tool struct {
+	Name        string
+	Description string
+
+	// Parameters describes the JSON object of arguments Call accepts.
+	Parameters *Schema
+
+	// Call runs the tool. Its result is sent back to the model as JSON.
+	Call func(ctx context.Context, args json.RawMessage) (interface{}, error)
+}
+
+// Agent is implemented by providers whose models can call tools.
+type Agent interface {
+	// RunTools sends prompt and runs the tools the model asks for, sending
+	// back their results, until the model answers. It fails if the model is
+	// still calling tools after maxSteps rounds of calls.
+	RunTools(ctx context.Context, prompt string, tools []Tool, maxSteps int) (string, error)
+}
+
+// CallTool runs the named tool from tools. A failing or unknown tool is
+// reported to the model as an error result rather than ending the run, so
+// the model can try something else.
+func CallTool(ctx context.Context, tools []Tool, name string, args json.RawMessage) interface{} {
+	for _, tool := range tools {
+		if tool.Name != name {
+			continue
+		}
+		result, err := tool.Call(ctx, args)
+		if err != nil {
+			return map[string]string{"error": err.Error()}
+		}
+		return result
+	}
+	return map[string]string{"error": "unknown tool " + name}
+}
+
+var _ Agent = (*GeminiProvider)(nil)
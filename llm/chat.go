@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Conversation is a multi-turn chat with a model that keeps its history.
+type Conversation interface {
+	// Send sends message and returns the reply, adding both to the history.
+	Send(ctx context.Context, message string) (string, error)
+	// SendStream is like Send but calls onText with each piece of the reply
+	// as it arrives.
+	SendStream(ctx context.Context, message string, onText func(string)) (string, error)
+	// Note adds an exchange to the history without sending anything, so
+	// later messages can refer to it.
+	Note(message, reply string)
+}
+
+// Chatter is implemented by providers that can hold a conversation.
+type Chatter interface {
+	// StartChat begins a conversation with system as its instructions.
+	StartChat(system string) Conversation
+}
+
+var (
+	_ Chatter = (*GeminiProvider)(nil)
+	_ Chatter = (*OpenAIProvider)(nil)
+	_ Chatter = (*OllamaProvider)(nil)
+)
+
+type geminiConversation struct {
+	session *genai.ChatSession
+}
+
+func (g *GeminiProvider) StartChat(system string) Conversation {
+	model := g.client.GenerativeModel(g.modelName)
+	model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(system)}}
+	return &geminiConversation{session: model.StartChat()}
+}
+
+func (c *geminiConversation) Send(ctx context.Context, message string) (string, error) {
+	resp, err := sendMessage(ctx, c.session, genai.Text(message))
+	if err != nil {
+		return "", err
+	}
+	return responseText(resp)
+}
+
+func (c *geminiConversation) SendStream(ctx context.Context, message string, onText func(string)) (string, error) {
+	n := len(c.session.History)
+	reply, err := streamText(ctx, onText, func(ctx context.Context) *genai.GenerateContentResponseIterator {
+		c.session.History = c.session.History[:n]
+		return c.session.SendMessageStream(ctx, genai.Text(message))
+	})
+	if err != nil {
+		c.session.History = c.session.History[:n]
+	}
+	return reply, err
+}
+
+func (c *geminiConversation) Note(message, reply string) {
+	c.session.History = append(c.session.History,
+		&genai.Content{Role: "user", Parts: []genai.Part{genai.Text(message)}},
+		&genai.Content{Role: "model", Parts: []genai.Part{genai.Text(reply)}},
+	)
+}
+
+// messageConversation keeps the history of a chat with a provider whose API
+// takes the whole conversation as a list of messages.
+type messageConversation struct {
+	messages []openAIMessage
+
+	// send sends messages, streaming the reply to onText unless it is nil.
+	send func(ctx context.Context, messages []openAIMessage, onText func(string)) (string, error)
+}
+
+func (c *messageConversation) Send(ctx context.Context, message string) (string, error) {
+	return c.SendStream(ctx, message, nil)
+}
+
+func (c *messageConversation) SendStream(ctx context.Context, message string, onText func(string)) (string, error) {
+	messages := append(c.messages, openAIMessage{Role: "user", Content: message})
+	reply, err := c.send(ctx, messages, onText)
+	if err != nil {
+		return "", err
+	}
+	c.messages = append(messages, openAIMessage{Role: "assistant", Content: reply})
+	return reply, nil
+}
+
+func (c *messageConversation) Note(message, reply string) {
+	c.messages = append(c.messages,
+		openAIMessage{Role: "user", Content: message},
+		openAIMessage{Role: "assistant", Content: reply},
+	)
+}
+
+func (o *OpenAIProvider) StartChat(system string) Conversation {
+	return &messageConversation{
+		messages: []openAIMessage{{Role: "system", Content: system}},
+		send: func(ctx context.Context, messages []openAIMessage, onText func(string)) (string, error) {
+			return o.chat(ctx, openAIChatRequest{Model: o.model, Messages: messages}, onText)
+		},
+	}
+}
+
+func (o *OllamaProvider) StartChat(system string) Conversation {
+	return &messageConversation{
+		messages: []openAIMessage{{Role: "system", Content: system}},
+		send: func(ctx context.Context, messages []openAIMessage, onText func(string)) (string, error) {
+			return o.chat(ctx, ollamaChatRequest{Model: o.model, Messages: messages}, onText)
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Reasons a response could not be used. A ResponseError wraps one of them,
+// so callers can tell them apart with errors.Is.
+var (
+	ErrBlocked       = errors.New("response blocked")
+	ErrMaxTokens     = errors.New("response cut off at the maximum number of tokens")
+	ErrEmptyResponse = errors.New("empty response")
+)
+
+// ResponseError explains why a model's response could not be used.
+type ResponseError struct {
+	// Err is ErrBlocked, ErrMaxTokens or ErrEmptyResponse.
+	Err error
+
+	// Reason is the provider's finish or block reason, and Ratings the
+	// safety categories that were flagged, if any.
+	Reason  string
+	Ratings []string
+
+	// Text is whatever was generated before the response ended.
+	Text string
+}
+
+func (e *ResponseError) Error() string {
+	msg := e.Err.Error()
+	if e.Reason != "" {
+		msg += fmt.Sprintf(" (%s)", e.Reason)
+	}
+	if len(e.Ratings) > 0 {
+		msg += ": " + strings.Join(e.Ratings, ", ")
+	}
+	return msg
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// checkText returns text, or an error if a response that finished for the
+// given reason can't be used. Providers map their finish reasons to blocked
+// and maxTokens.
+func checkText(text, reason string, blocked, maxTokens bool) (string, error) {
+	switch {
+	case blocked:
+		return "", &ResponseError{Err: ErrBlocked, Reason: reason, Text: text}
+	case maxTokens:
+		return "", &ResponseError{Err: ErrMaxTokens, Reason: reason, Text: text}
+	case strings.TrimSpace(text) == "":
+		return "", &ResponseError{Err: ErrEmptyResponse, Reason: reason}
+	}
+	return text, nil
+}
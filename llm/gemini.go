@@ -0,0 +1,273 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"socialbot/retry"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+type GeminiProvider struct {
+	client    *genai.Client
+	modelName string
+}
+
+func NewGeminiProvider(ctx context.Context, apiKey, modelName string) (*GeminiProvider, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %v", err)
+	}
+
+	return &GeminiProvider{
+		client:    client,
+		modelName: modelName,
+	}, nil
+}
+
+func (g *GeminiProvider) Name() string {
+	return "gemini/" + g.modelName
+}
+
+func (g *GeminiProvider) GenerateContent(ctx context.Context, prompt string) (string, error) {
+	return generate(ctx, g.model(nil), prompt)
+}
+
+func (g *GeminiProvider) GenerateJSON(ctx context.Context, prompt string, schema *Schema) (string, error) {
+	return generate(ctx, g.model(schema), prompt)
+}
+
+func (g *GeminiProvider) Stream(ctx context.Context, prompt string, schema *Schema, onText func(string)) (string, error) {
+	model := g.model(schema)
+	return streamText(ctx, onText, func(ctx context.Context) *genai.GenerateContentResponseIterator {
+		return model.GenerateContentStream(ctx, genai.Text(prompt))
+	})
+}
+
+// model returns the configured model, asking for JSON matching schema
+// unless it is nil.
+func (g *GeminiProvider) model(schema *Schema) *genai.GenerativeModel {
+	model := g.client.GenerativeModel(g.modelName)
+	if schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = schema.genai()
+	}
+	return model
+}
+
+func generate(ctx context.Context, model *genai.GenerativeModel, prompt string) (string, error) {
+	var resp *genai.GenerateContentResponse
+	err := retry.Do(ctx, "generate content", func(ctx context.Context) error {
+		var err error
+		resp, err = model.GenerateContent(ctx, genai.Text(prompt))
+		return err
+	})
+	if err != nil {
+		return "", geminiError(err)
+	}
+	return responseText(resp)
+}
+
+// sendMessage sends parts in session. A failed send is taken back out of
+// the session's history, so it can be retried.
+func sendMessage(ctx context.Context, session *genai.ChatSession, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	n := len(session.History)
+	var resp *genai.GenerateContentResponse
+	err := retry.Do(ctx, "send message", func(ctx context.Context) error {
+		var err error
+		resp, err = session.SendMessage(ctx, parts...)
+		if err != nil {
+			session.History = session.History[:n]
+		}
+		return err
+	})
+	if err != nil {
+		return nil, geminiError(err)
+	}
+	return resp, nil
+}
+
+func (g *GeminiProvider) CountTokens(ctx context.Context, prompt string) (int, error) {
+	model := g.client.GenerativeModel(g.modelName)
+	var resp *genai.CountTokensResponse
+	err := retry.Do(ctx, "count tokens", func(ctx context.Context) error {
+		var err error
+		resp, err = model.CountTokens(ctx, genai.Text(prompt))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.TotalTokens), nil
+}
+
+func (g *GeminiProvider) Close() error {
+	return g.client.Close()
+}
+
+func (g *GeminiProvider) RunTools(ctx context.Context, prompt string, tools []Tool, maxSteps int) (string, error) {
+	model := g.client.GenerativeModel(g.modelName)
+	declarations := make([]*genai.FunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		declarations = append(declarations, &genai.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.Parameters.genai(),
+		})
+	}
+	model.Tools = []*genai.Tool{{FunctionDeclarations: declarations}}
+
+	session := model.StartChat()
+	parts := []genai.Part{genai.Text(prompt)}
+	for step := 0; ; step++ {
+		resp, err := sendMessage(ctx, session, parts...)
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			return responseText(resp)
+		}
+
+		var calls []genai.FunctionCall
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if call, ok := part.(genai.FunctionCall); ok {
+				calls = append(calls, call)
+			}
+		}
+		if len(calls) == 0 {
+			return responseText(resp)
+		}
+		if step == maxSteps {
+			return "", fmt.Errorf("model still calling tools after %d steps", maxSteps)
+		}
+
+		parts = nil
+		for _, call := range calls {
+			args, err := json.Marshal(call.Args)
+			if err != nil {
+				return "", fmt.Errorf("failed to decode %s arguments: %v", call.Name, err)
+			}
+			result, err := functionResult(CallTool(ctx, tools, call.Name, args))
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, genai.FunctionResponse{Name: call.Name, Response: result})
+		}
+	}
+}
+
+// functionResult converts a tool's result to the JSON object Gemini expects
+// in a function response.
+func functionResult(result interface{}) (map[string]any, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tool result: %v", err)
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to encode tool result: %v", err)
+	}
+	return map[string]any{"result": value}, nil
+}
+
+// streamText passes each piece of text from the response that start streams
+// to onText and returns the whole text. The stream is started again if it
+// fails before any text arrives.
+func streamText(ctx context.Context, onText func(string), start func(ctx context.Context) *genai.GenerateContentResponseIterator) (string, error) {
+	var text strings.Builder
+	var merged *genai.GenerateContentResponse
+	err := retry.Do(ctx, "stream content", func(ctx context.Context) error {
+		iter := start(ctx)
+		for {
+			resp, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil && text.Len() > 0 {
+				return retry.Permanent(err)
+			}
+			if err != nil {
+				return err
+			}
+			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+				continue
+			}
+			for _, part := range resp.Candidates[0].Content.Parts {
+				if chunk, ok := part.(genai.Text); ok {
+					onText(string(chunk))
+					text.WriteString(string(chunk))
+				}
+			}
+		}
+		merged = iter.MergedResponse()
+		return nil
+	})
+	if err != nil {
+		return "", geminiError(err)
+	}
+
+	if merged != nil {
+		return responseText(merged)
+	}
+	return checkText(text.String(), "", false, false)
+}
+
+// responseText joins the text parts of the first candidate in resp, or
+// explains why it has none that can be used.
+func responseText(resp *genai.GenerateContentResponse) (string, error) {
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+		return "", geminiError(&genai.BlockedError{PromptFeedback: resp.PromptFeedback})
+	}
+	if len(resp.Candidates) == 0 {
+		return checkText("", "no candidates", false, false)
+	}
+
+	candidate := resp.Candidates[0]
+	if candidate.FinishReason == genai.FinishReasonSafety || candidate.FinishReason == genai.FinishReasonRecitation {
+		return "", geminiError(&genai.BlockedError{Candidate: candidate})
+	}
+	var text strings.Builder
+	if candidate.Content != nil {
+		for _, part := range candidate.Content.Parts {
+			if chunk, ok := part.(genai.Text); ok {
+				text.WriteString(string(chunk))
+			}
+		}
+	}
+	reason := strings.TrimPrefix(candidate.FinishReason.String(), "FinishReason")
+	return checkText(text.String(), reason, false, candidate.FinishReason == genai.FinishReasonMaxTokens)
+}
+
+// geminiError turns the errors genai reports for blocked prompts and
+// responses into a ResponseError.
+func geminiError(err error) error {
+	var blocked *genai.BlockedError
+	if !errors.As(err, &blocked) {
+		return fmt.Errorf("failed to generate response: %v", err)
+	}
+
+	result := &ResponseError{Err: ErrBlocked}
+	var ratings []*genai.SafetyRating
+	if blocked.PromptFeedback != nil {
+		result.Reason = "prompt " + strings.TrimPrefix(blocked.PromptFeedback.BlockReason.String(), "BlockReason")
+		ratings = blocked.PromptFeedback.SafetyRatings
+	}
+	if blocked.Candidate != nil {
+		result.Reason = strings.TrimPrefix(blocked.Candidate.FinishReason.String(), "FinishReason")
+		ratings = blocked.Candidate.SafetyRatings
+	}
+	for _, rating := range ratings {
+		if rating.Blocked || rating.Probability >= genai.HarmProbabilityMedium {
+			result.Ratings = append(result.Ratings, fmt.Sprintf("%s %s",
+				strings.TrimPrefix(rating.Category.String(), "HarmCategory"),
+				strings.TrimPrefix(rating.Probability.String(), "HarmProbability")))
+		}
+	}
+	return result
+}
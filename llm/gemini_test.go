@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestResponseText(t *testing.T) {
+	candidate := func(reason genai.FinishReason, parts ...genai.Part) *genai.GenerateContentResponse {
+		return &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+			Content:      &genai.Content{Parts: parts},
+			FinishReason: reason,
+		}}}
+	}
+
+	got, err := responseText(candidate(genai.FinishReasonStop, genai.Text("Hello, "), genai.Text("world")))
+	if err != nil || got != "Hello, world" {
+		t.Errorf("responseText = %q, %v; want all parts joined", got, err)
+	}
+
+	for _, test := range []struct {
+		name string
+		resp *genai.GenerateContentResponse
+		want error
+	}{
+		{"no candidates", &genai.GenerateContentResponse{}, ErrEmptyResponse},
+		{"no text", candidate(genai.FinishReasonStop), ErrEmptyResponse},
+		{"max tokens", candidate(genai.FinishReasonMaxTokens, genai.Text("Hello")), ErrMaxTokens},
+		{"unsafe response", candidate(genai.FinishReasonSafety), ErrBlocked},
+		{"unsafe prompt", &genai.GenerateContentResponse{PromptFeedback: &genai.PromptFeedback{
+			BlockReason: genai.BlockReasonSafety,
+			SafetyRatings: []*genai.SafetyRating{
+				{Category: genai.HarmCategoryHarassment, Probability: genai.HarmProbabilityHigh, Blocked: true},
+				{Category: genai.HarmCategoryHateSpeech, Probability: genai.HarmProbabilityNegligible},
+			},
+		}}, ErrBlocked},
+	} {
+		_, err := responseText(test.resp)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: responseText error = %v, want %v", test.name, err, test.want)
+		}
+		if test.name == "unsafe prompt" && err.Error() != "response blocked (prompt Safety): Harassment High" {
+			t.Errorf("%s: error message = %q", test.name, err)
+		}
+	}
+}
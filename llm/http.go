@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"socialbot/retry"
+)
+
+// postJSON sends body as JSON to url and decodes the JSON response into out.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, out interface{}) error {
+	return retry.Do(ctx, "POST "+url, func(ctx context.Context) error {
+		resp, err := post(ctx, client, url, headers, body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+		return nil
+	})
+}
+
+// postStream sends body as JSON to url and calls onLine with each line of
+// the response as it arrives, until the response ends or onLine returns
+// errStreamDone.
+func postStream(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}, onLine func(line []byte) error) error {
+	return retry.Do(ctx, "POST "+url, func(ctx context.Context) error {
+		resp, err := post(ctx, client, url, headers, body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		// Errors while reading the response aren't retried, since part of
+		// it may already have been handed on.
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if err := onLine(line); err == errStreamDone {
+				return nil
+			} else if err != nil {
+				return retry.Permanent(err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return retry.Permanent(fmt.Errorf("failed to read response: %v", err))
+		}
+		return nil
+	})
+}
+
+// errStreamDone is returned by postStream callbacks at the end of a stream.
+var errStreamDone = errors.New("stream done")
+
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := retry.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
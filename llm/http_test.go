@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIRetriesRateLimit(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":"rate limited"}`, http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	got, err := NewOpenAIProvider(srv.URL, "", "test").GenerateContent(context.Background(), "Hi")
+	if err != nil || got != "Hello" || requests != 2 {
+		t.Errorf("GenerateContent = %q, %v after %d requests; want Hello after 2", got, err, requests)
+	}
+}
+
+func TestOpenAIStreamNotRepeated(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: not json\n\n")
+	}))
+	defer srv.Close()
+
+	var streamed string
+	_, err := NewOpenAIProvider(srv.URL, "", "test").Stream(context.Background(), "Hi", nil, func(text string) {
+		streamed += text
+	})
+	if err == nil || streamed != "Hel" || requests != 1 {
+		t.Errorf("Stream streamed %q, error %v after %d requests; want Hel, an error and 1 request", streamed, err, requests)
+	}
+}
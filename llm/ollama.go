@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OllamaProvider talks to a local Ollama server's native chat API.
+type OllamaProvider struct {
+	host   string
+	model  string
+	client *http.Client
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+
+	// Format constrains the reply to JSON matching a schema.
+	Format *Schema `json:"format,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message    openAIMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+}
+
+func NewOllamaProvider(host, model string) *OllamaProvider {
+	return &OllamaProvider{
+		host:   strings.TrimRight(host, "/"),
+		model:  model,
+		client: http.DefaultClient,
+	}
+}
+
+func (o *OllamaProvider) Name() string {
+	return "ollama/" + o.model
+}
+
+func (o *OllamaProvider) GenerateContent(ctx context.Context, prompt string) (string, error) {
+	return o.chat(ctx, o.request(prompt, nil), nil)
+}
+
+func (o *OllamaProvider) GenerateJSON(ctx context.Context, prompt string, schema *Schema) (string, error) {
+	return o.chat(ctx, o.request(prompt, schema), nil)
+}
+
+func (o *OllamaProvider) Stream(ctx context.Context, prompt string, schema *Schema, onText func(string)) (string, error) {
+	return o.chat(ctx, o.request(prompt, schema), onText)
+}
+
+func (o *OllamaProvider) request(prompt string, schema *Schema) ollamaChatRequest {
+	return ollamaChatRequest{
+		Model:    o.model,
+		Messages: []openAIMessage{{Role: "user", Content: prompt}},
+		Format:   schema,
+	}
+}
+
+// chat sends req, streaming the response to onText unless it is nil.
+func (o *OllamaProvider) chat(ctx context.Context, req ollamaChatRequest, onText func(string)) (string, error) {
+	if onText == nil {
+		var resp ollamaChatResponse
+		if err := postJSON(ctx, o.client, o.host+"/api/chat", nil, req, &resp); err != nil {
+			return "", fmt.Errorf("failed to generate response: %v", err)
+		}
+		return ollamaText(resp.Message.Content, resp.DoneReason)
+	}
+
+	req.Stream = true
+	var text strings.Builder
+	var doneReason string
+	err := postStream(ctx, o.client, o.host+"/api/chat", nil, req, func(line []byte) error {
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+		onText(chunk.Message.Content)
+		text.WriteString(chunk.Message.Content)
+		if chunk.Done {
+			doneReason = chunk.DoneReason
+			return errStreamDone
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate response: %v", err)
+	}
+	return ollamaText(text.String(), doneReason)
+}
+
+func ollamaText(text, doneReason string) (string, error) {
+	return checkText(text, doneReason, false, doneReason == "length")
+}
+
+func (o *OllamaProvider) CountTokens(ctx context.Context, prompt string) (int, error) {
+	return 0, ErrTokenCountUnsupported
+}
+
+func (o *OllamaProvider) Close() error {
+	return nil
+}
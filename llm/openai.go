@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider talks to any server implementing the OpenAI chat completions
+// API, including local servers such as llama.cpp, vLLM and LM Studio.
+type OpenAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string  `json:"name"`
+		Schema *Schema `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  http.DefaultClient,
+	}
+}
+
+func (o *OpenAIProvider) Name() string {
+	return "openai/" + o.model
+}
+
+func (o *OpenAIProvider) GenerateContent(ctx context.Context, prompt string) (string, error) {
+	return o.chat(ctx, o.request(prompt, nil), nil)
+}
+
+func (o *OpenAIProvider) GenerateJSON(ctx context.Context, prompt string, schema *Schema) (string, error) {
+	return o.chat(ctx, o.request(prompt, schema), nil)
+}
+
+func (o *OpenAIProvider) Stream(ctx context.Context, prompt string, schema *Schema, onText func(string)) (string, error) {
+	return o.chat(ctx, o.request(prompt, schema), onText)
+}
+
+func (o *OpenAIProvider) request(prompt string, schema *Schema) openAIChatRequest {
+	req := openAIChatRequest{
+		Model:    o.model,
+		Messages: []openAIMessage{{Role: "user", Content: prompt}},
+	}
+	if schema != nil {
+		req.ResponseFormat = &openAIResponseFormat{Type: "json_schema"}
+		req.ResponseFormat.JSONSchema.Name = "response"
+		req.ResponseFormat.JSONSchema.Schema = schema
+	}
+	return req
+}
+
+// chat sends req, streaming the response to onText unless it is nil.
+func (o *OpenAIProvider) chat(ctx context.Context, req openAIChatRequest, onText func(string)) (string, error) {
+	headers := map[string]string{}
+	if o.apiKey != "" {
+		headers["Authorization"] = "Bearer " + o.apiKey
+	}
+
+	if onText == nil {
+		var resp openAIChatResponse
+		if err := postJSON(ctx, o.client, o.baseURL+"/chat/completions", headers, req, &resp); err != nil {
+			return "", fmt.Errorf("failed to generate response: %v", err)
+		}
+		if len(resp.Choices) == 0 {
+			return checkText("", "no choices", false, false)
+		}
+		return openAIText(resp.Choices[0].Message.Content, resp.Choices[0].FinishReason)
+	}
+
+	// Streamed responses are server-sent events, one chunk per data line.
+	req.Stream = true
+	var text strings.Builder
+	var finishReason string
+	err := postStream(ctx, o.client, o.baseURL+"/chat/completions", headers, req, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return nil
+		}
+		data = bytes.TrimSpace(data)
+		if string(data) == "[DONE]" {
+			return errStreamDone
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+		if len(chunk.Choices) > 0 {
+			onText(chunk.Choices[0].Delta.Content)
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			if chunk.Choices[0].FinishReason != "" {
+				finishReason = chunk.Choices[0].FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate response: %v", err)
+	}
+	return openAIText(text.String(), finishReason)
+}
+
+func openAIText(text, finishReason string) (string, error) {
+	return checkText(text, finishReason, finishReason == "content_filter", finishReason == "length")
+}
+
+func (o *OpenAIProvider) CountTokens(ctx context.Context, prompt string) (int, error) {
+	return 0, ErrTokenCountUnsupported
+}
+
+func (o *OpenAIProvider) Close() error {
+	return nil
+}
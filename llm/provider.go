@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"socialbot/config"
+)
+
+// ErrTokenCountUnsupported is returned by providers whose API has no way to
+// count tokens for a prompt.
+var ErrTokenCountUnsupported = errors.New("token counting not supported by provider")
+
+// Provider is a large language model backend that SocialAssistant can chat with.
+type Provider interface {
+	// Name identifies the provider and model in logs.
+	Name() string
+	// GenerateContent sends a single prompt and returns the model's text response.
+	GenerateContent(ctx context.Context, prompt string) (string, error)
+	// GenerateJSON is like GenerateContent but uses the provider's
+	// structured output mode to ask for JSON matching schema.
+	GenerateJSON(ctx context.Context, prompt string, schema *Schema) (string, error)
+	// CountTokens reports how many tokens the prompt uses.
+	CountTokens(ctx context.Context, prompt string) (int, error)
+	// Close releases any resources held by the provider.
+	Close() error
+}
+
+// Streamer is implemented by providers that can send a response as it is
+// generated.
+type Streamer interface {
+	// Stream is like GenerateContent, or GenerateJSON if schema is not nil,
+	// but calls onText with each piece of the response as it arrives.
+	Stream(ctx context.Context, prompt string, schema *Schema, onText func(string)) (string, error)
+}
+
+var (
+	_ Streamer = (*GeminiProvider)(nil)
+	_ Streamer = (*OpenAIProvider)(nil)
+	_ Streamer = (*OllamaProvider)(nil)
+)
+
+// Providers lists the names accepted by NewProvider.
+var Providers = []string{"gemini", "openai", "ollama"}
+
+// DefaultProvider returns the provider named by LLM_PROVIDER, or gemini.
+func DefaultProvider() string {
+	if name := os.Getenv("LLM_PROVIDER"); name != "" {
+		return name
+	}
+	return "gemini"
+}
+
+// NewProvider creates the named provider, configured from the environment.
+func NewProvider(ctx context.Context, name string) (Provider, error) {
+	switch strings.ToLower(name) {
+	case "gemini":
+		return NewGeminiProvider(ctx, os.Getenv("GEMINI_API_KEY"), config.EnvOr("GEMINI_MODEL", "models/gemini-1.5-flash"))
+	case "openai":
+		return NewOpenAIProvider(
+			config.EnvOr("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+			os.Getenv("OPENAI_API_KEY"),
+			config.EnvOr("OPENAI_MODEL", "gpt-4o-mini"),
+		), nil
+	case "ollama":
+		return NewOllamaProvider(
+			config.EnvOr("OLLAMA_HOST", "http://localhost:11434"),
+			config.EnvOr("OLLAMA_MODEL", "llama3"),
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q (expected one of: %s)", name, strings.Join(Providers, ", "))
+	}
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Schema describes the JSON a model should reply with. It covers the subset
+// of JSON Schema that every provider's structured output mode accepts.
+type Schema struct {
+	// Type is one of "object", "array", "string", "integer", "number" or
+	// "boolean".
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+func (s *Schema) genai() *genai.Schema {
+	if s == nil {
+		return nil
+	}
+
+	types := map[string]genai.Type{
+		"object":  genai.TypeObject,
+		"array":   genai.TypeArray,
+		"string":  genai.TypeString,
+		"integer": genai.TypeInteger,
+		"number":  genai.TypeNumber,
+		"boolean": genai.TypeBoolean,
+	}
+	schema := &genai.Schema{
+		Type:        types[s.Type],
+		Description: s.Description,
+		Enum:        s.Enum,
+		Items:       s.Items.genai(),
+		Required:    s.Required,
+	}
+	if len(s.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema)
+		for name, property := range s.Properties {
+			schema.Properties[name] = property.genai()
+		}
+	}
+	return schema
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			t.Errorf("request = %+v, %v; want a streaming request", req, err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{"Hello", ", ", "world"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var chunks []string
+	got, err := NewOpenAIProvider(srv.URL, "", "test").Stream(context.Background(), "Hi", nil, func(text string) {
+		chunks = append(chunks, text)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if got != "Hello, world" || strings.Join(chunks, "|") != "Hello|, |world" {
+		t.Errorf("Stream = %q in chunks %q", got, chunks)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hello"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":" there"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`)
+	}))
+	defer srv.Close()
+
+	conversation := NewOllamaProvider(srv.URL, "test").StartChat("Be brief.")
+	var chunks []string
+	got, err := conversation.SendStream(context.Background(), "Hi", func(text string) {
+		chunks = append(chunks, text)
+	})
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	if got != "Hello there" || strings.Join(chunks, "") != "Hello there" {
+		t.Errorf("SendStream = %q in chunks %q", got, chunks)
+	}
+
+	messages := conversation.(*messageConversation).messages
+	if len(messages) != 3 || messages[2].Content != "Hello there" {
+		t.Errorf("conversation history = %+v, want system, question and reply", messages)
+	}
+}
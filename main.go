@@ -3,120 +3,546 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net/mail"
 	"os"
+	"os/signal"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"socialbot/config"
+	"socialbot/llm"
+	"socialbot/retry"
+	"socialbot/scoring"
 	"socialbot/tools"
 
 	"github.com/golang/glog"
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
 )
 
 type SocialAssistant struct {
-	model *genai.Client
-	ctx   context.Context
+	provider        string
+	llm             llm.Provider
+	mail            tools.MailSource
+	calendar        tools.CalendarSource
+	scheduler       tools.Scheduler
+	feeds           tools.FeedSource
+	contacts        *config.Identities
+	days            int
+	ahead           int
+	top             int
+	steps           int
+	verbose         bool
+	backend         string
+	calendarBackend string
+	store           string
+	now             func() time.Time
+	in              *bufio.Reader
+	out             io.Writer
+	ctx             context.Context
+
+	// stream, if set, is shown LLM responses as they are generated.
+	stream io.Writer
 }
 
-func NewSocialAssistant() (*SocialAssistant, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create client: %v", err)
+// NewSocialAssistant sets up the assistant. Backends and the LLM provider
+// are only connected to once a command needs them.
+func NewSocialAssistant(provider, backend, calendarBackend, store string, days, ahead, top int) *SocialAssistant {
+	opts := config.AddressOptionsFromEnv()
+	return &SocialAssistant{
+		provider:        provider,
+		feeds:           tools.NewRSSReader(),
+		contacts:        config.NewIdentities(config.GetImportantContacts(opts), opts),
+		days:            days,
+		ahead:           ahead,
+		top:             top,
+		backend:         backend,
+		calendarBackend: calendarBackend,
+		store:           store,
+		now:             time.Now,
+		in:              bufio.NewReader(os.Stdin),
+		out:             os.Stdout,
+		ctx:             context.Background(),
 	}
+}
 
-	return &SocialAssistant{
-		model: client,
-		ctx:   ctx,
-	}, nil
+// model returns the LLM provider, creating it on first use so that commands
+// which don't need it work without any LLM configured.
+func (s *SocialAssistant) model() (llm.Provider, error) {
+	if s.llm == nil {
+		model, err := llm.NewProvider(s.ctx, s.provider)
+		if err != nil {
+			return nil, err
+		}
+		s.llm = model
+	}
+	return s.llm, nil
 }
 
-func (s *SocialAssistant) Chat(input string) (string, error) {
-	modelName := os.Getenv("GEMINI_MODEL")
-	if modelName == "" {
-		modelName = "models/gemini-1.5-flash"
+// Close releases the LLM provider if one was created.
+func (s *SocialAssistant) Close() error {
+	if s.llm == nil {
+		return nil
+	}
+	return s.llm.Close()
+}
+
+// mailSource returns the configured mail backend, connecting on first use.
+func (s *SocialAssistant) mailSource() tools.MailSource {
+	if s.mail != nil {
+		return s.mail
+	}
+
+	var store *tools.InteractionStore
+	if s.store != "" {
+		var err error
+		if store, err = tools.LoadInteractionStore(s.store); err != nil {
+			glog.Warningf("Not using interaction store: %v", err)
+		}
+	}
+
+	if s.backend == "imap" {
+		imapTool := tools.NewIMAPTool(tools.IMAPConfigFromEnv(), s.contacts)
+		if store != nil {
+			imapTool.Archive = store.ArchivedMessages()
+		}
+		s.mail = imapTool
+	} else {
+		emailTool := tools.NewEmailTool(s.contacts)
+		emailTool.Store = store
+		s.mail = emailTool
 	}
-	glog.Infof("Using Gemini model: %s", modelName)
-	model := s.model.GenerativeModel(modelName)
-	tokResp, err := model.CountTokens(s.ctx, genai.Text(input))
+	return s.mail
+}
+
+// calendarSource returns the configured calendar backend, connecting on first use.
+func (s *SocialAssistant) calendarSource() tools.CalendarSource {
+	if s.calendar != nil {
+		return s.calendar
+	}
+
+	switch s.calendarBackend {
+	case "ics":
+		sources := config.SplitList(os.Getenv("ICS_CALENDARS"))
+		if len(sources) == 0 {
+			glog.Exit("ICS_CALENDARS is not set")
+		}
+		s.calendar = tools.NewICSTool(sources)
+	case "caldav":
+		s.calendar = tools.NewCalDAVTool(tools.CalDAVConfigFromEnv())
+	default:
+		s.calendar = tools.NewCalendarTool()
+	}
+	return s.calendar
+}
+
+// schedulerSource returns the Google Calendar scheduler, asking for
+// permission to create events on first use.
+func (s *SocialAssistant) schedulerSource() tools.Scheduler {
+	if s.scheduler == nil {
+		s.scheduler = tools.NewSchedulingCalendarTool()
+	}
+	return s.scheduler
+}
+
+// findContact looks up an important contact by any of their email addresses.
+func (s *SocialAssistant) findContact(email string) *config.Contact {
+	return s.contacts.Resolve(email)
+}
+
+func (s *SocialAssistant) readLine() string {
+	line, _ := s.in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+func (s *SocialAssistant) Chat(input string) (string, error) {
+	model, err := s.model()
 	if err != nil {
-		glog.Errorf("Error counting tokens: %v", err)
+		return "", err
 	}
+	s.logPrompt(model, input)
+	return s.generate(model, input, nil)
+}
+
+// generate sends prompt to model, asking for JSON matching schema unless it
+// is nil. The response is streamed to s.stream if it is set and the model
+// supports streaming.
+func (s *SocialAssistant) generate(model llm.Provider, prompt string, schema *llm.Schema) (string, error) {
+	streamer, ok := model.(llm.Streamer)
+	if s.stream == nil || !ok {
+		if schema != nil {
+			return model.GenerateJSON(s.ctx, prompt, schema)
+		}
+		return model.GenerateContent(s.ctx, prompt)
+	}
+
+	response, err := streamer.Stream(s.ctx, prompt, schema, func(text string) {
+		fmt.Fprint(s.stream, text)
+	})
+	fmt.Fprintln(s.stream)
+	return response, err
+}
+
+// streamWriter records whether anything was streamed to w.
+type streamWriter struct {
+	w    io.Writer
+	used bool
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.used = true
+	return s.w.Write(p)
+}
+
+func (s *SocialAssistant) logPrompt(model llm.Provider, prompt string) {
+	glog.Infof("Using LLM provider: %s", model.Name())
 
 	// Add debug logging for the prompt
-	glog.Infof("Sending prompt to Gemini:\n%s", input)
+	glog.Infof("Sending prompt to LLM:\n%s", prompt)
+
+	if tokens, err := model.CountTokens(s.ctx, prompt); err != nil {
+		glog.V(1).Infof("Not counting tokens: %v", err)
+	} else {
+		glog.Infof("Chatting with LLM: %d tokens", tokens)
+	}
+}
 
-	glog.Infof("Chatting with Gemini: %d tokens", tokResp.TotalTokens)
-	resp, err := model.GenerateContent(s.ctx, genai.Text(input))
+// maxJSONAttempts is how many times ChatJSON asks for a valid response.
+const maxJSONAttempts = 3
+
+// ChatJSON asks the LLM for JSON matching schema and hands the response to
+// parse. If parse rejects it, the LLM is asked again with the error, up to
+// maxJSONAttempts times.
+func (s *SocialAssistant) ChatJSON(input string, schema *llm.Schema, parse func(response string) error) error {
+	model, err := s.model()
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %v", err)
+		return err
+	}
+
+	prompt := input
+	for attempt := 1; ; attempt++ {
+		s.logPrompt(model, prompt)
+		response, err := s.generate(model, prompt, schema)
+		if err != nil {
+			return err
+		}
+
+		err = parse(response)
+		if err == nil {
+			return nil
+		}
+		if attempt == maxJSONAttempts {
+			return fmt.Errorf("invalid response after %d attempts: %v", attempt, err)
+		}
+		glog.Warningf("Asking again after invalid LLM response: %v", err)
+		prompt = fmt.Sprintf("%s\n\nYour previous response was:\n%s\n\nIt was rejected because %v. Please reply again with corrected JSON.", input, response, err)
 	}
+}
 
-	return fmt.Sprint(resp.Candidates[0].Content.Parts[0]), nil
+// socialHistory is the email and calendar data recommendations are based on.
+type socialHistory struct {
+	Events   []tools.Event
+	Upcoming []tools.Event
+
+	// Interactions summarizes email and past meetings with each contact.
+	Interactions []tools.EmailInteraction
 }
 
-func (s *SocialAssistant) GetSocialRecommendations() (string, error) {
-	calendarTool := tools.NewCalendarTool()
-	emailTool := tools.NewEmailTool()
+// loadHistory reads the given number of days of mail and calendar history,
+// plus upcoming events.
+func (s *SocialAssistant) loadHistory(days int) (*socialHistory, error) {
+	since := s.now().AddDate(0, 0, -days)
 
-	// Get data from last 30 days
-	since := time.Now().AddDate(0, 0, -30)
+	events, err := s.calendarSource().GetRecentEvents(s.ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar events: %v", err)
+	}
 
-	events, err := calendarTool.GetRecentEvents(s.ctx, since)
+	upcoming, err := s.calendarSource().GetUpcomingEvents(s.ctx, s.now().AddDate(0, 0, s.ahead))
 	if err != nil {
-		return "", fmt.Errorf("failed to get calendar events: %v", err)
+		return nil, fmt.Errorf("failed to get upcoming calendar events: %v", err)
 	}
 
-	interactions, err := emailTool.GetRecentInteractions(s.ctx, since, "")
+	interactions, err := s.mailSource().GetRecentInteractions(s.ctx, since, "")
 	if err != nil {
-		return "", fmt.Errorf("failed to get email interactions: %v", err)
+		return nil, fmt.Errorf("failed to get email interactions: %v", err)
+	}
+
+	return &socialHistory{
+		Events:       events,
+		Upcoming:     upcoming,
+		Interactions: tools.MergeMeetings(interactions, events, s.contacts),
+	}, nil
+}
+
+func (s *SocialAssistant) rank(history *socialHistory) []scoring.Score {
+	return scoring.Rank(scoring.Input{
+		Now:          s.now(),
+		Days:         s.days,
+		Contacts:     s.contacts,
+		Interactions: history.Interactions,
+		Upcoming:     history.Upcoming,
+	})
+}
+
+// RankContacts scores every important contact without involving the LLM.
+func (s *SocialAssistant) RankContacts() ([]scoring.Score, error) {
+	history, err := s.loadHistory(s.days)
+	if err != nil {
+		return nil, err
+	}
+	return s.rank(history), nil
+}
+
+// maxOverdueDays caps how far back overdue reads history to cover cadences,
+// so a long cadence doesn't turn it into a scan of years of mail. A larger
+// -days still applies.
+const maxOverdueDays = 365
+
+// OverdueContacts lists contacts past their cadence without involving the
+// LLM. History is read far enough back to cover the longest cadence twice,
+// up to maxOverdueDays, or -days if that is longer.
+func (s *SocialAssistant) OverdueContacts() ([]scoring.OverdueContact, int, error) {
+	days := s.days
+	longest := int(math.Ceil(2 * scoring.LongestCadence(s.contacts.Contacts()).Hours() / 24))
+	if longest = min(longest, maxOverdueDays); longest > days {
+		days = longest
+	}
+
+	history, err := s.loadHistory(days)
+	if err != nil {
+		return nil, 0, err
+	}
+	return scoring.Overdue(scoring.Input{
+		Now:          s.now(),
+		Days:         days,
+		Contacts:     s.contacts,
+		Interactions: history.Interactions,
+	}), days, nil
+}
+
+// Recommendation is the LLM's advice about reaching out to one contact.
+type Recommendation struct {
+	Email  string  `json:"email"`
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+	Action string  `json:"action"`
+	Opener string  `json:"opener"`
+}
+
+// recommendationsSchema is the JSON the LLM is asked to recommend with. Name
+// and Score come from the ranking rather than the LLM.
+var recommendationsSchema = &llm.Schema{
+	Type: "object",
+	Properties: map[string]*llm.Schema{
+		"recommendations": {
+			Type: "array",
+			Items: &llm.Schema{
+				Type: "object",
+				Properties: map[string]*llm.Schema{
+					"email":  {Type: "string", Description: "The contact's email address as listed in the ranking"},
+					"reason": {Type: "string", Description: "Why to reach out this week, in a sentence or two"},
+					"action": {Type: "string", Description: "What to do, e.g. send an email about a topic or suggest a coffee"},
+					"opener": {Type: "string", Description: "A first line to send them, or empty if there is no need to reach out"},
+				},
+				Required: []string{"email", "reason", "action", "opener"},
+			},
+		},
+	},
+	Required: []string{"recommendations"},
+}
+
+// GetSocialRecommendations ranks contacts and asks the LLM to turn the top
+// of the ranking into recommendations, in ranking order.
+func (s *SocialAssistant) GetSocialRecommendations() ([]Recommendation, error) {
+	history, err := s.loadHistory(s.days)
+	if err != nil {
+		return nil, err
+	}
+
+	top := s.rank(history)
+	top = top[:min(max(s.top, 1), len(top))]
+	include := make(map[string]bool)
+	for _, score := range top {
+		include[score.Contact.Email] = true
+	}
+
+	var events []tools.Event
+	for _, event := range s.withContacts(history.Events, include) {
+		events = append(events, event.Event)
+	}
+	var interactions []tools.EmailInteraction
+	for _, interaction := range history.Interactions {
+		if include[interaction.Participant] {
+			interactions = append(interactions, interaction)
+		}
 	}
 
 	// Format data for Gemini
-	prompt := formatSocialDataPrompt(events, interactions)
-	return s.Chat(prompt)
+	prompt := formatSocialDataPrompt(socialData{
+		Ranking:      top,
+		Events:       events,
+		Upcoming:     s.withContacts(history.Upcoming, include),
+		Interactions: interactions,
+		Contacts:     s.contacts,
+		Days:         s.days,
+		Ahead:        s.ahead,
+	})
+
+	var recommendations []Recommendation
+	err = s.ChatJSON(prompt, recommendationsSchema, func(response string) error {
+		var err error
+		recommendations, err = parseRecommendations(response, top, s.contacts)
+		return err
+	})
+	return recommendations, err
 }
 
-func (s *SocialAssistant) DraftEmail(to string) (string, error) {
-	emailTool := tools.NewEmailTool()
-	rssReader := tools.NewRSSReader()
+// parseRecommendations checks that the LLM recommended each of the top
+// contacts exactly once and returns the recommendations in ranking order.
+func parseRecommendations(response string, top []scoring.Score, contacts *config.Identities) ([]Recommendation, error) {
+	var reply struct {
+		Recommendations []Recommendation `json:"recommendations"`
+	}
+	if err := json.Unmarshal([]byte(response), &reply); err != nil {
+		return nil, fmt.Errorf("it is not valid JSON: %v", err)
+	}
 
-	// Find the specific contact and their details
-	var targetInteraction *tools.EmailInteraction
-	var targetContact *config.Contact
-	contacts := config.GetImportantContacts()
+	byEmail := make(map[string]Recommendation)
+	for _, recommendation := range reply.Recommendations {
+		contact := contacts.Resolve(recommendation.Email)
+		if contact == nil {
+			return nil, fmt.Errorf("%q is not one of my contacts", recommendation.Email)
+		}
+		if _, ok := byEmail[contact.Email]; ok {
+			return nil, fmt.Errorf("%s is recommended more than once", contact.Email)
+		}
+		if strings.TrimSpace(recommendation.Reason) == "" || strings.TrimSpace(recommendation.Action) == "" {
+			return nil, fmt.Errorf("the recommendation for %s has no reason or action", contact.Email)
+		}
+		recommendation.Email = contact.Email
+		byEmail[contact.Email] = recommendation
+	}
 
-	for _, contact := range contacts {
-		if contact.Email == to {
-			targetContact = &contact
-			break
+	var result []Recommendation
+	for _, score := range top {
+		recommendation, ok := byEmail[score.Contact.Email]
+		if !ok {
+			return nil, fmt.Errorf("there is no recommendation for %s", score.Contact.Email)
+		}
+		delete(byEmail, score.Contact.Email)
+		recommendation.Name = score.Contact.Name
+		recommendation.Score = score.Total
+		result = append(result, recommendation)
+	}
+	for email := range byEmail {
+		return nil, fmt.Errorf("%s is not one of the contacts listed", email)
+	}
+	return result, nil
+}
+
+// formatRecommendations lays recommendations out as a table.
+func formatRecommendations(recommendations []Recommendation) string {
+	var result strings.Builder
+	w := tabwriter.NewWriter(&result, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tCONTACT\tSCORE\tREASON\tACTION\tOPENER")
+	for i, r := range recommendations {
+		fmt.Fprintf(w, "%d\t%s <%s>\t%.1f\t%s\t%s\t%s\n", i+1, r.Name, r.Email, r.Score, oneLine(r.Reason), oneLine(r.Action), oneLine(r.Opener))
+	}
+	w.Flush()
+	return result.String()
+}
+
+// oneLine keeps a table cell on one line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// contactEvent is an event together with the important contacts attending it.
+type contactEvent struct {
+	tools.Event
+	Contacts []*config.Contact
+}
+
+// withContacts keeps only the events attended by at least one of the
+// included contacts, keyed by primary email.
+func (s *SocialAssistant) withContacts(events []tools.Event, include map[string]bool) []contactEvent {
+	var result []contactEvent
+	for _, event := range events {
+		var contacts []*config.Contact
+		seen := make(map[string]bool)
+		for _, attendee := range event.Attendees {
+			if contact := s.contacts.Resolve(attendee); contact != nil && include[contact.Email] && !seen[contact.Email] {
+				seen[contact.Email] = true
+				contacts = append(contacts, contact)
+			}
+		}
+		if len(contacts) > 0 {
+			result = append(result, contactEvent{Event: event, Contacts: contacts})
+		}
+	}
+	return result
+}
+
+// DraftOptions are extra recipients and files for a drafted email.
+type DraftOptions struct {
+	Cc          []string
+	Bcc         []string
+	Attachments []string
+}
+
+func (s *SocialAssistant) DraftEmail(to string, opts DraftOptions) (string, error) {
+	var attachments []tools.Attachment
+	for _, path := range opts.Attachments {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read attachment: %v", err)
 		}
+		attachments = append(attachments, tools.NewAttachment(path, data))
 	}
 
+	emailTool := s.mailSource()
+
+	// Find the specific contact and their details
+	var targetInteraction *tools.EmailInteraction
+	targetContact := s.findContact(to)
 	if targetContact == nil {
 		return "", fmt.Errorf("contact not found in important contacts: %s", to)
 	}
 
-	interactions, err := emailTool.GetInteractionsByParticipant(s.ctx, targetContact.Email)
+	interactions, err := emailTool.GetInteractionsByParticipant(s.ctx, targetContact.Email, s.now().AddDate(0, 0, -30))
 	if err != nil {
 		return "", fmt.Errorf("failed to get email interactions: %v", err)
 	}
 
 	for _, interaction := range interactions {
-		if interaction.Participant == to {
+		if interaction.Participant == targetContact.Email {
 			targetInteraction = &interaction
 			break
 		}
 	}
 
+	// Offer to reply in the most recent conversation with them
+	thread, err := emailTool.GetLatestThread(s.ctx, targetContact.Email)
+	if err != nil {
+		glog.Warningf("Warning: Failed to find latest thread: %v", err)
+	} else if thread != nil {
+		fmt.Fprintf(s.out, "\nReply in your most recent thread %q (%s)? (Y/N): ", thread.Subject, formatDate(thread.Date))
+		if strings.ToUpper(s.readLine()) != "Y" {
+			thread = nil
+		}
+	}
+
 	// Get their recent blog posts if available
 	var recentPosts []tools.BlogPost
 	if targetContact.RSSFeed != "" {
-		posts, err := rssReader.GetRecentPosts(targetContact.RSSFeed, 3)
+		posts, err := s.feeds.GetRecentPosts(s.ctx, targetContact.RSSFeed, 3)
 		if err != nil {
 			glog.Warningf("Warning: Failed to fetch RSS feed: %v", err)
 		} else {
@@ -126,83 +552,172 @@ func (s *SocialAssistant) DraftEmail(to string) (string, error) {
 
 	var feedback string
 	for {
-		prompt := formatEmailDraftPrompt(targetContact, targetInteraction, recentPosts, feedback)
-		response, err := s.Chat(prompt)
+		prompt := formatEmailDraftPrompt(targetContact, targetInteraction, thread, recentPosts, feedback)
+		var draft tools.DraftEmail
+		err := s.ChatJSON(prompt, draftSchema, func(response string) error {
+			var err error
+			draft, err = parseDraft(response)
+			return err
+		})
 		if err != nil {
-			return "", err
+			if s.ctx.Err() != nil {
+				return "", err
+			}
+			fmt.Fprintf(s.out, "\nCouldn't draft the email: %v\n%s\n", err, llmErrorHint(err))
+			fmt.Fprint(s.out, "Retry (R), change the request (C) or give up (Q)? ")
+			switch strings.ToUpper(s.readLine()) {
+			case "R":
+			case "C":
+				fmt.Fprint(s.out, "\nWhat would you like to change? (e.g., 'Keep it short', 'Leave out the health news'): ")
+				feedback = s.readLine()
+			default:
+				return "", err
+			}
+			continue
 		}
-
-		// Parse the response into subject and body
-		draft, err := parseEmailResponse(response)
-		if err != nil {
-			return "", fmt.Errorf("failed to parse email response: %v", err)
+		if thread != nil {
+			draft.ReplyTo(*thread)
 		}
+		draft.To = to
+		draft.Cc = mergeAddresses(opts.Cc, draft.Cc)
+		draft.Bcc = opts.Bcc
+		draft.Attachments = attachments
 
 		// Display the draft to the user
-		fmt.Println("\nProposed Email Draft:")
-		fmt.Println("===================")
-		fmt.Printf("To: %s\n", to)
-		fmt.Printf("Subject: %s\n\n", draft.Subject)
-		fmt.Println(draft.Body)
-		fmt.Println("===================")
+		fmt.Fprintln(s.out, "\nProposed Email Draft:")
+		fmt.Fprintln(s.out, "===================")
+		fmt.Fprintf(s.out, "To: %s\n", to)
+		if len(draft.Cc) > 0 {
+			fmt.Fprintf(s.out, "Cc: %s\n", strings.Join(draft.Cc, ", "))
+		}
+		if len(draft.Bcc) > 0 {
+			fmt.Fprintf(s.out, "Bcc: %s\n", strings.Join(draft.Bcc, ", "))
+		}
+		for _, attachment := range draft.Attachments {
+			fmt.Fprintf(s.out, "Attachment: %s (%d bytes)\n", attachment.Filename, len(attachment.Data))
+		}
+		fmt.Fprintf(s.out, "Subject: %s\n\n", draft.Subject)
+		fmt.Fprintln(s.out, draft.Body)
+		fmt.Fprintln(s.out, "===================")
 
 		// Ask for user approval
-		fmt.Print("\nWould you like to use this draft? (Y/N): ")
-		var approval string
-		fmt.Scanln(&approval)
+		fmt.Fprint(s.out, "\nWould you like to use this draft? (Y/N): ")
+		approval := s.readLine()
 
 		if strings.ToUpper(approval) == "Y" {
-			// Create draft in Gmail
-			draft.To = to
+			// Save the draft with the mail backend
 			if err := emailTool.SaveDraft(s.ctx, draft); err != nil {
 				return "", fmt.Errorf("failed to save draft: %v", err)
 			}
-			return fmt.Sprintf("Draft saved to Gmail:\n\n%s", response), nil
+			return fmt.Sprintf("Draft saved:\n\nSubject: %s\n\n%s", draft.Subject, draft.Body), nil
 		}
 
 		// If not approved, ask for feedback
-		fmt.Print("\nWhat would you like to change? (e.g., 'Make it more formal', 'Add more personal details'): ")
-		scanner := bufio.NewScanner(os.Stdin)
-		scanner.Scan()
-		feedback = scanner.Text()
+		fmt.Fprint(s.out, "\nWhat would you like to change? (e.g., 'Make it more formal', 'Add more personal details'): ")
+		feedback = s.readLine()
 	}
 }
 
-func parseEmailResponse(response string) (tools.DraftEmail, error) {
-	lines := strings.Split(response, "\n")
-	var draft tools.DraftEmail
-	var bodyLines []string
-	inBody := false
+// llmErrorHint suggests what to do about a failed LLM request.
+func llmErrorHint(err error) string {
+	switch {
+	case errors.Is(err, llm.ErrBlocked):
+		return "The response was blocked by the provider's safety filters. Rewording the request may help."
+	case errors.Is(err, llm.ErrMaxTokens):
+		return "The response was too long. Asking for a shorter email may help."
+	case errors.Is(err, llm.ErrEmptyResponse):
+		return "The LLM returned nothing. Trying again may help."
+	default:
+		return "Trying again may help if the problem was temporary."
+	}
+}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Subject: ") {
-			draft.Subject = strings.TrimPrefix(line, "Subject: ")
-		} else if line == "" && draft.Subject != "" {
-			inBody = true
-		} else if inBody {
-			bodyLines = append(bodyLines, line)
-		}
+// draftSchema is the JSON the LLM is asked to draft an email with.
+var draftSchema = &llm.Schema{
+	Type: "object",
+	Properties: map[string]*llm.Schema{
+		"subject": {Type: "string", Description: "The subject line, without a \"Subject:\" prefix"},
+		"body":    {Type: "string", Description: "The plain text email body, from greeting to sign-off"},
+		"cc": {
+			Type:        "array",
+			Description: "Email addresses to copy, only if someone else clearly belongs in the conversation",
+			Items:       &llm.Schema{Type: "string"},
+		},
+	},
+	Required: []string{"subject", "body"},
+}
+
+// parseDraft decodes and checks a draft written by the LLM.
+func parseDraft(response string) (tools.DraftEmail, error) {
+	var reply struct {
+		Subject string   `json:"subject"`
+		Body    string   `json:"body"`
+		Cc      []string `json:"cc"`
+	}
+	if err := json.Unmarshal([]byte(response), &reply); err != nil {
+		return tools.DraftEmail{}, fmt.Errorf("it is not valid JSON: %v", err)
 	}
 
+	draft := tools.DraftEmail{
+		Subject: strings.TrimSpace(reply.Subject),
+		Body:    strings.TrimSpace(reply.Body),
+	}
 	if draft.Subject == "" {
-		return draft, fmt.Errorf("no subject found in response")
+		return draft, fmt.Errorf("the subject is empty")
+	}
+	if strings.Contains(draft.Subject, "\n") {
+		return draft, fmt.Errorf("the subject spans more than one line")
+	}
+	if draft.Body == "" {
+		return draft, fmt.Errorf("the body is empty")
+	}
+	for _, cc := range reply.Cc {
+		address, err := mail.ParseAddress(cc)
+		if err != nil {
+			return draft, fmt.Errorf("cc %q is not an email address", cc)
+		}
+		draft.Cc = append(draft.Cc, address.Address)
 	}
-
-	draft.Body = strings.Join(bodyLines, "\n")
 	return draft, nil
 }
 
-func formatEmailDraftPrompt(contact *config.Contact, interaction *tools.EmailInteraction, posts []tools.BlogPost, feedback string) string {
+// mergeAddresses appends the addresses in extra that aren't already in
+// addresses, ignoring case.
+func mergeAddresses(addresses, extra []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, address := range append(append([]string{}, addresses...), extra...) {
+		if key := strings.ToLower(address); !seen[key] {
+			seen[key] = true
+			result = append(result, address)
+		}
+	}
+	return result
+}
+
+func formatEmailDraftPrompt(contact *config.Contact, interaction *tools.EmailInteraction, thread *tools.Thread, posts []tools.BlogPost, feedback string) string {
 	var context strings.Builder
 
 	if interaction != nil {
-		fmt.Fprintf(&context, "Last contact was on %s, with %d total interactions. ",
+		fmt.Fprintf(&context, "Last contact was on %s, with %d total interactions (%d from them, last %s; %d from me, last %s). ",
 			interaction.LastContact.Format("2006-01-02"),
-			interaction.Count)
+			interaction.Count,
+			interaction.ReceivedCount,
+			formatDate(interaction.LastReceived),
+			interaction.SentCount,
+			formatDate(interaction.LastSent))
+		if interaction.AwaitingReply() {
+			context.WriteString("They are waiting on a reply from me. ")
+		}
 	} else {
 		context.WriteString("No previous email interactions found. ")
 	}
 
+	if thread != nil {
+		fmt.Fprintf(&context, "This email is a reply in our existing thread %q, so it should read as a follow-up to that conversation. ",
+			thread.Subject)
+	}
+
 	if len(posts) > 0 {
 		context.WriteString("\n\nRecent blog posts:\n")
 		for _, post := range posts {
@@ -242,37 +757,121 @@ Please write a natural, personal email that:
 
 %s
 
-Format the response as:
-Subject: [subject]
+Reply with the subject line and the email body separately. Only suggest Cc addresses if someone else clearly belongs in the conversation.`, contact.Name, contact.Email, writingSample, context.String(), feedbackSection)
+}
 
-[email body]`, contact.Name, contact.Email, writingSample, context.String(), feedbackSection)
+// socialData is everything the recommendation prompt is built from.
+type socialData struct {
+	Ranking      []scoring.Score
+	Events       []tools.Event
+	Upcoming     []contactEvent
+	Interactions []tools.EmailInteraction
+	Contacts     *config.Identities
+	Days         int
+	Ahead        int
 }
 
-func formatSocialDataPrompt(events []tools.Event, interactions []tools.EmailInteraction) string {
+func formatSocialDataPrompt(data socialData) string {
 	return fmt.Sprintf(`Based on the following data about my important contacts, who should I reach out to this week?
 
-Calendar Events (Last 30 days):
+Top Contacts by Score (highest first):
 %v
+Scores add up points for contact priority, time since last contact against how often I aim to be in touch, how often we interacted by email and in meetings, replies I owe, and upcoming events.
 
-Important Contact Interactions (Last 30 days):
+Calendar Events (Last %d days):
 %v
 
-Please recommend 3 or less important contacts I should reach out to this week. 
-Consider factors like:
-1. Contact priority (1-5, where 5 is highest)
-2. Time since last contact
-3. Frequency of past interactions
-4. Any upcoming events
-`, formatEvents(events), formatInteractions(interactions))
+Upcoming Events with Important Contacts (Next %d days):
+%v
+
+Important Contact Interactions (Last %d days):
+%v
+
+Give one recommendation for each of the top contacts, and no others: their email address as listed, why I should reach out this week in a sentence or two, a suggested action, and an opener I could send them.
+
+If I'm already seeing someone soon in an upcoming event, don't recommend reaching out to them; say so as the action instead (e.g. "You're seeing Jane on Thursday, no need to reach out") and leave the opener empty.
+`, formatRanking(data.Ranking), data.Days, formatEvents(data.Events, data.Contacts), data.Ahead, formatUpcomingEvents(data.Upcoming), data.Days, formatInteractions(data.Interactions))
+}
+
+func formatContacts(contacts []config.Contact) string {
+	var result strings.Builder
+	for _, contact := range contacts {
+		fmt.Fprintf(&result, "- %s (%s) [Priority: %d, cadence: %s]", contact.Name, contact.Email, contact.Priority, scoring.DescribeCadence(contact))
+		if contact.RSSFeed != "" {
+			result.WriteString(" [has a blog]")
+		}
+		result.WriteString("\n")
+	}
+	return result.String()
+}
+
+func formatRanking(scores []scoring.Score) string {
+	var result strings.Builder
+	for i, score := range scores {
+		fmt.Fprintf(&result, "%d. %s (%s): score %.1f\n", i+1, score.Contact.Name, score.Contact.Email, score.Total)
+		for _, reason := range score.Reasons {
+			fmt.Fprintf(&result, "   - %s\n", reason)
+		}
+	}
+	return result.String()
+}
+
+func formatOverdue(overdue []scoring.OverdueContact, days int) string {
+	if len(overdue) == 0 {
+		return "Nobody is overdue.\n"
+	}
+
+	var result strings.Builder
+	for _, o := range overdue {
+		fmt.Fprintf(&result, "- %s (%s): ", o.Contact.Name, o.Contact.Email)
+		overdueDays := int(o.Overdue.Hours() / 24)
+		if o.LastContact.IsZero() {
+			fmt.Fprintf(&result, "at least %d days overdue (cadence: %s, no contact in the last %d days)\n", overdueDays, scoring.DescribeCadence(o.Contact), days)
+		} else {
+			fmt.Fprintf(&result, "%d days overdue (cadence: %s, last contact %s)\n", overdueDays, scoring.DescribeCadence(o.Contact), formatDate(o.LastContact))
+		}
+	}
+	return result.String()
+}
+
+func formatUpcomingEvents(events []contactEvent) string {
+	if len(events) == 0 {
+		return "None\n"
+	}
+
+	var result strings.Builder
+	for _, event := range events {
+		names := make([]string, 0, len(event.Contacts))
+		for _, contact := range event.Contacts {
+			names = append(names, fmt.Sprintf("%s (%s)", contact.Name, contact.Email))
+		}
+		fmt.Fprintf(&result, "- %s with %s on %s", event.Title, strings.Join(names, ", "), event.StartTime.Format("Monday 2006-01-02"))
+		if event.AllDay {
+			result.WriteString(" (all day)")
+		}
+		result.WriteString("\n")
+	}
+	return result.String()
 }
 
-func formatEvents(events []tools.Event) string {
+func formatEvents(events []tools.Event, contacts *config.Identities) string {
 	var result strings.Builder
 	for _, event := range events {
-		result.WriteString(fmt.Sprintf("- %s with %s on %s\n",
+		attendees := make([]string, 0, len(event.Attendees))
+		for _, attendee := range event.Attendees {
+			if contact := contacts.Resolve(attendee); contact != nil {
+				attendee = fmt.Sprintf("%s (%s)", contact.Name, contact.Email)
+			}
+			attendees = append(attendees, attendee)
+		}
+		result.WriteString(fmt.Sprintf("- %s with %s on %s",
 			event.Title,
-			strings.Join(event.Attendees, ", "),
+			strings.Join(attendees, ", "),
 			event.StartTime.Format("2006-01-02")))
+		if event.AllDay {
+			result.WriteString(" (all day)")
+		}
+		result.WriteString("\n")
 	}
 	return result.String()
 }
@@ -280,27 +879,38 @@ func formatEvents(events []tools.Event) string {
 func formatInteractions(interactions []tools.EmailInteraction) string {
 	var result strings.Builder
 	for _, interaction := range interactions {
-		result.WriteString(fmt.Sprintf("- %s (%s) [Priority: %d] (Last contact: %s, Total interactions: %d)\n",
+		result.WriteString(fmt.Sprintf("- %s (%s) [Priority: %d] (Last contact: %s, Emails: %d, Received: %d, last %s, Sent: %d, last %s, Meetings: %d (%d 1:1, weighted %.1f), last met %s)",
 			interaction.Name,
 			interaction.Participant,
 			interaction.Priority,
 			interaction.LastContact.Format("2006-01-02"),
-			interaction.Count))
+			interaction.Count,
+			interaction.ReceivedCount,
+			formatDate(interaction.LastReceived),
+			interaction.SentCount,
+			formatDate(interaction.LastSent),
+			interaction.MeetingCount,
+			interaction.OneOnOneCount,
+			interaction.MeetingWeight,
+			formatDate(interaction.LastMet)))
+		if interaction.AwaitingReply() {
+			result.WriteString(" [Waiting on my reply]")
+		}
+		result.WriteString("\n")
 	}
 	return result.String()
 }
 
-func (s *SocialAssistant) CatchupWithBlog(email string) (string, error) {
-	// Find the contact
-	contacts := config.GetImportantContacts()
-	var targetContact *config.Contact
-	for _, contact := range contacts {
-		if contact.Email == email {
-			targetContact = &contact
-			break
-		}
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "never"
 	}
+	return t.Format("2006-01-02")
+}
 
+func (s *SocialAssistant) CatchupWithBlog(email string) (string, error) {
+	// Find the contact
+	targetContact := s.findContact(email)
 	if targetContact == nil {
 		return "", fmt.Errorf("contact not found in important contacts: %s", email)
 	}
@@ -310,14 +920,13 @@ func (s *SocialAssistant) CatchupWithBlog(email string) (string, error) {
 	}
 
 	// Get recent posts
-	rssReader := tools.NewRSSReader()
-	posts, err := rssReader.GetRecentPosts(targetContact.RSSFeed, 10) // Get more posts to filter by date
+	posts, err := s.feeds.GetRecentPosts(s.ctx, targetContact.RSSFeed, 10) // Get more posts to filter by date
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch RSS feed: %v", err)
 	}
 
 	// Filter to last week
-	weekAgo := time.Now().AddDate(0, 0, -30)
+	weekAgo := s.now().AddDate(0, 0, -30)
 	var recentPosts []tools.BlogPost
 	for _, post := range posts {
 		if post.Published.After(weekAgo) {
@@ -333,6 +942,87 @@ func (s *SocialAssistant) CatchupWithBlog(email string) (string, error) {
 	return s.Chat(prompt)
 }
 
+// ScheduleOptions controls the catch-up slots ScheduleCatchup proposes.
+type ScheduleOptions struct {
+	Duration time.Duration
+	Hours    tools.WorkingHours
+	Slots    int
+}
+
+// ScheduleCatchup proposes free slots for a catch-up with a contact and, once
+// one is chosen, puts a tentative hold on my calendar, optionally inviting
+// the contact.
+func (s *SocialAssistant) ScheduleCatchup(email string, opts ScheduleOptions) (string, error) {
+	contact := s.findContact(email)
+	if contact == nil {
+		return "", fmt.Errorf("contact not found in important contacts: %s", email)
+	}
+
+	now := s.now()
+	until := now.AddDate(0, 0, s.ahead)
+	busy, err := s.schedulerSource().FreeBusy(s.ctx, now, until)
+	if err != nil {
+		return "", fmt.Errorf("failed to get free/busy: %v", err)
+	}
+
+	zones := []*time.Location{now.Location()}
+	if contact.TimeZone != "" {
+		zones = append(zones, contact.Location())
+	}
+	slots := tools.ProposeSlots(busy, tools.SlotOptions{
+		From:     now,
+		To:       until,
+		Duration: opts.Duration,
+		Hours:    opts.Hours,
+		Zones:    zones,
+		Count:    opts.Slots,
+	})
+	if len(slots) == 0 {
+		return "", fmt.Errorf("no free %v slots within working hours in the next %d days", opts.Duration, s.ahead)
+	}
+
+	fmt.Fprintf(s.out, "\nProposed times for a catch-up with %s:\n", contact.Name)
+	for i, slot := range slots {
+		fmt.Fprintf(s.out, "%d. %s", i+1, formatSlot(slot, zones[0]))
+		if len(zones) > 1 {
+			fmt.Fprintf(s.out, " (%s for %s)", formatSlot(slot, zones[1]), contact.Name)
+		}
+		fmt.Fprintln(s.out)
+	}
+
+	fmt.Fprintf(s.out, "\nChoose a slot (1-%d), or press Enter to cancel: ", len(slots))
+	var choice int
+	if _, err := fmt.Sscan(s.readLine(), &choice); err != nil || choice < 1 || choice > len(slots) {
+		return "No slot chosen; nothing was scheduled.", nil
+	}
+	slot := slots[choice-1]
+
+	hold := tools.Hold{
+		Title:       fmt.Sprintf("Catch up with %s", contact.Name),
+		Description: fmt.Sprintf("Catch-up with %s (%s).", contact.Name, contact.Email),
+		Slot:        slot,
+	}
+	fmt.Fprintf(s.out, "\nSend an invitation to %s? (Y/N): ", contact.Email)
+	if strings.ToUpper(s.readLine()) == "Y" {
+		hold.Invite = []string{contact.Email}
+	}
+
+	link, err := s.schedulerSource().CreateHold(s.ctx, hold)
+	if err != nil {
+		return "", fmt.Errorf("failed to create hold: %v", err)
+	}
+
+	result := fmt.Sprintf("Tentative hold %q created for %s", hold.Title, formatSlot(slot, zones[0]))
+	if len(hold.Invite) > 0 {
+		result += fmt.Sprintf(", invitation sent to %s", contact.Email)
+	}
+	return result + "\n" + link, nil
+}
+
+func formatSlot(slot tools.TimeRange, loc *time.Location) string {
+	return fmt.Sprintf("%s-%s", slot.Start.In(loc).Format("Monday 2006-01-02 15:04"), slot.End.In(loc).Format("15:04 MST"))
+}
+
 func formatCatchupPrompt(contact *config.Contact, posts []tools.BlogPost) string {
 	var postsBuilder strings.Builder
 	for _, post := range posts {
@@ -354,33 +1044,160 @@ Please provide:
 Keep the summary concise but informative.`, contact.Name, postsBuilder.String())
 }
 
+// importMail adds the messages in an mbox or Maildir archive to the
+// interaction store at storePath.
+func importMail(path, storePath string, me []string) (added, total int, err error) {
+	store, err := tools.LoadInteractionStore(storePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	messages, err := tools.ImportMailArchive(path, me)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	added = store.Import(messages)
+	if err := store.Save(); err != nil {
+		return 0, 0, err
+	}
+	return added, len(messages), nil
+}
+
+func defaultStore() string {
+	if path, ok := os.LookupEnv("MAIL_STORE"); ok {
+		return path
+	}
+	return "interactions.json"
+}
+
 func main() {
-	cmd := flag.String("cmd", "recommend", "Command to run: 'recommend', 'draft', or 'catchup'")
-	email := flag.String("email", "", "Email address for draft/catchup command")
+	cmd := flag.String("cmd", "recommend", "Command to run: 'recommend', 'rank', 'overdue', 'draft', 'catchup', 'schedule', 'agent', 'chat' or 'import-mail'. "+
+		"'overdue' lists contacts past their cadence; one without a cadence is due weekly at priority 5 down to every 180 days at priority 1")
+	email := flag.String("email", "", "Email address for draft/catchup/schedule command")
+	provider := flag.String("provider", llm.DefaultProvider(), "LLM provider: "+strings.Join(llm.Providers, ", "))
+	backend := flag.String("mail", config.EnvOr("MAIL_BACKEND", "gmail"), "Mail backend: 'gmail' or 'imap'")
+	calendarBackend := flag.String("calendar", config.EnvOr("CALENDAR_BACKEND", "google"), "Calendar backend: 'google', 'ics' or 'caldav'")
+	store := flag.String("store", defaultStore(), "Local interaction store file synced with Gmail (empty to always query Gmail directly)")
+	days := flag.Int("days", 30, "Number of days of history to consider for recommendations, and the least overdue reads (it reads twice the longest cadence, up to a year)")
+	ahead := flag.Int("ahead", 14, "Number of days ahead to consider upcoming events for recommendations, or to look for free slots for schedule")
+	top := flag.Int("top", 3, "Number of top-ranked contacts to ask the LLM about for recommend command")
+	format := flag.String("format", "table", "Output format for recommend command: 'table' or 'json'")
+	question := flag.String("question", DefaultQuestion, "Question for agent command")
+	steps := flag.Int("steps", 8, "Maximum rounds of tool calls for agent command")
+	verbose := flag.Bool("verbose", false, "Print each tool call the LLM makes for agent command")
+	stream := flag.Bool("stream", true, "Show LLM responses as they are generated for catchup and chat commands, and for recommend if set explicitly")
+	timeout := flag.Duration("timeout", retry.Default.Timeout, "Deadline for each attempt at a mail, calendar, feed or LLM call, which is retried if it runs out (0 for none)")
+	cc := flag.String("cc", "", "Comma-separated Cc addresses for draft command")
+	bcc := flag.String("bcc", "", "Comma-separated Bcc addresses for draft command")
+	attach := flag.String("attach", "", "Comma-separated files to attach for draft command")
+	duration := flag.Duration("duration", 30*time.Minute, "Length of the catch-up for schedule command")
+	slots := flag.Int("slots", 3, "Number of slots to propose for schedule command")
+	archive := flag.String("path", "", "mbox file or Maildir directory for import-mail command")
+	me := flag.String("me", os.Getenv("MY_EMAILS"), "Comma-separated addresses you send mail from, for import-mail command")
 	flag.Parse()
+	streamSet := false
+	flag.Visit(func(f *flag.Flag) {
+		streamSet = streamSet || f.Name == "stream"
+	})
 
-	assistant, err := NewSocialAssistant()
-	if err != nil {
-		glog.Exitf("Failed to initialize assistant: %v", err)
+	if *backend != "gmail" && *backend != "imap" {
+		glog.Exitf("Unknown mail backend: %s", *backend)
+	}
+	if *calendarBackend != "google" && *calendarBackend != "ics" && *calendarBackend != "caldav" {
+		glog.Exitf("Unknown calendar backend: %s", *calendarBackend)
+	}
+	if *format != "table" && *format != "json" {
+		glog.Exitf("Unknown output format: %s", *format)
+	}
+	if *top <= 0 {
+		glog.Exitf("Invalid top: %d (must be at least 1)", *top)
+	}
+	if *timeout < 0 {
+		glog.Exitf("Invalid timeout: %v", *timeout)
+	}
+	retry.Default.Timeout = *timeout
+
+	// Importing archives is offline and needs neither contacts nor an LLM.
+	if *cmd == "import-mail" {
+		if *archive == "" {
+			glog.Exit("Archive path is required for import-mail command")
+		}
+		if *store == "" {
+			glog.Exit("An interaction store (-store) is required for import-mail command")
+		}
+		added, total, err := importMail(*archive, *store, config.SplitList(*me))
+		if err != nil {
+			glog.Exitf("Failed to import mail: %v", err)
+		}
+		fmt.Printf("Imported %d new messages from %s (%d read)\n", added, *archive, total)
+		return
+	}
+
+	assistant := NewSocialAssistant(*provider, *backend, *calendarBackend, *store, *days, *ahead, *top)
+	defer assistant.Close()
+	assistant.steps = *steps
+	assistant.verbose = *verbose
+
+	// Ctrl-C cancels whatever the assistant is waiting on. The chat command
+	// handles it itself, cancelling only the current turn.
+	if *cmd != "chat" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		assistant.ctx = ctx
 	}
-	defer assistant.model.Close()
 
 	switch *cmd {
 	case "recommend":
 		glog.Infof("Getting social recommendations")
+		if *stream && streamSet {
+			// The response is JSON, so it is only shown when asked for, and
+			// on stderr to keep the output clean.
+			assistant.stream = os.Stderr
+		}
 		recommendations, err := assistant.GetSocialRecommendations()
 		if err != nil {
 			glog.Exitf("Failed to get recommendations: %v", err)
 		}
+		if *format == "json" {
+			out, err := json.MarshalIndent(recommendations, "", "  ")
+			if err != nil {
+				glog.Exitf("Failed to encode recommendations: %v", err)
+			}
+			fmt.Println(string(out))
+			break
+		}
 		fmt.Println("Social Recommendations:")
-		fmt.Println(recommendations)
+		fmt.Print(formatRecommendations(recommendations))
+
+	case "rank":
+		glog.Infof("Ranking contacts")
+		scores, err := assistant.RankContacts()
+		if err != nil {
+			glog.Exitf("Failed to rank contacts: %v", err)
+		}
+		fmt.Println("Contact Ranking:")
+		fmt.Print(formatRanking(scores))
+
+	case "overdue":
+		glog.Infof("Finding overdue contacts")
+		overdue, days, err := assistant.OverdueContacts()
+		if err != nil {
+			glog.Exitf("Failed to find overdue contacts: %v", err)
+		}
+		fmt.Println("Overdue Contacts:")
+		fmt.Print(formatOverdue(overdue, days))
 
 	case "draft":
 		glog.Infof("Drafting email to %s", *email)
 		if *email == "" {
 			glog.Fatal("Email address is required for draft command")
 		}
-		draft, err := assistant.DraftEmail(*email)
+		draft, err := assistant.DraftEmail(*email, DraftOptions{
+			Cc:          config.SplitList(*cc),
+			Bcc:         config.SplitList(*bcc),
+			Attachments: config.SplitList(*attach),
+		})
 		if err != nil {
 			glog.Exitf("Failed to draft email: %v", err)
 		}
@@ -392,12 +1209,51 @@ func main() {
 		if *email == "" {
 			glog.Fatal("Email address is required for catchup command")
 		}
+		fmt.Println("Blog Catchup Summary:")
+		var streamed streamWriter
+		if *stream {
+			streamed.w = os.Stdout
+			assistant.stream = &streamed
+		}
 		summary, err := assistant.CatchupWithBlog(*email)
 		if err != nil {
 			glog.Exitf("Failed to get blog catchup: %v", err)
 		}
-		fmt.Println("Blog Catchup Summary:")
-		fmt.Println(summary)
+		if !streamed.used {
+			fmt.Println(summary)
+		}
+
+	case "schedule":
+		glog.Infof("Scheduling a catch-up with %s", *email)
+		if *email == "" {
+			glog.Fatal("Email address is required for schedule command")
+		}
+		result, err := assistant.ScheduleCatchup(*email, ScheduleOptions{
+			Duration: *duration,
+			Hours:    tools.WorkingHoursFromEnv(),
+			Slots:    *slots,
+		})
+		if err != nil {
+			glog.Exitf("Failed to schedule catch-up: %v", err)
+		}
+		fmt.Println(result)
+
+	case "agent":
+		glog.Infof("Answering with tools: %s", *question)
+		answer, err := assistant.RunAgent(*question)
+		if err != nil {
+			glog.Exitf("Failed to answer: %v", err)
+		}
+		fmt.Println(answer)
+
+	case "chat":
+		glog.Infof("Starting chat")
+		if *stream {
+			assistant.stream = os.Stdout
+		}
+		if err := assistant.ChatLoop(); err != nil {
+			glog.Exitf("Failed to chat: %v", err)
+		}
 
 	default:
 		glog.Exitf("Unknown command: %s", *cmd)
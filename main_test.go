@@ -0,0 +1,686 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"socialbot/config"
+	"socialbot/fake"
+	"socialbot/llm"
+	"socialbot/tools"
+)
+
+var update = flag.Bool("update", false, "rewrite golden prompt files in testdata")
+
+var testNow = time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC)
+
+// testAddressOptions strips plus tags so Ada+blog@ counts as Ada.
+var testAddressOptions = config.AddressOptions{StripPlus: true, GmailDots: true}
+
+var testContacts = []config.Contact{
+	{
+		Email:         "ada@example.com",
+		Name:          "Ada Lovelace",
+		Priority:      5,
+		Aliases:       []string{"ada@work.example.com"},
+		TimeZone:      "America/New_York",
+		RSSFeed:       "https://ada.example.com/feed",
+		WritingSample: "Hi Ada,\n\nHope the engine is humming.\n\nCheers,\nMe",
+	},
+	{
+		Email:    "grace@example.com",
+		Name:     "Grace Hopper",
+		Priority: 3,
+	},
+}
+
+type testEnv struct {
+	assistant *SocialAssistant
+	llm       *fake.LLM
+	mailbox   *fake.Mailbox
+	calendar  *fake.Calendar
+}
+
+func newTestEnv(input string, responses ...string) *testEnv {
+	model := &fake.LLM{Responses: responses}
+	contacts := config.NewIdentities(testContacts, testAddressOptions)
+	mailbox := &fake.Mailbox{
+		Identities: contacts,
+		Now:        testNow,
+		Messages: []tools.Message{
+			{ID: "1", From: "ada@example.com", Date: testNow.AddDate(0, 0, -3)},
+			{ID: "2", From: "ada@example.com", Date: testNow.AddDate(0, 0, -10)},
+			{ID: "3", From: "grace@example.com", Date: testNow.AddDate(0, 0, -20)},
+			{ID: "4", From: "newsletter@example.com", Date: testNow.AddDate(0, 0, -1)},
+			{ID: "5", From: "grace@example.com", Date: testNow.AddDate(0, 0, -45)},
+			{ID: "6", From: "me@example.com", To: []string{"grace@example.com"}, Cc: []string{"ada@example.com"}, Date: testNow.AddDate(0, 0, -15), Sent: true},
+			{ID: "7", From: "me@example.com", To: []string{"ada@example.com"}, Date: testNow.AddDate(0, 0, -2), Sent: true},
+			{ID: "8", From: "grace@example.com", To: []string{"me@example.com"}, Date: testNow.AddDate(0, 0, -5)},
+			{ID: "9", From: "Ada+blog@Example.com", Date: testNow.AddDate(0, 0, -6)},
+			{ID: "10", From: "me@example.com", To: []string{"ada@work.example.com", "ada@example.com"}, Date: testNow.AddDate(0, 0, -8), Sent: true},
+		},
+	}
+	calendar := &fake.Calendar{
+		Now: testNow,
+		Events: []tools.Event{
+			{
+				Title:     "Coffee",
+				StartTime: testNow.AddDate(0, 0, -7),
+				EndTime:   testNow.AddDate(0, 0, -7).Add(time.Hour),
+				Attendees: []string{"me@example.com", "grace@example.com"},
+			},
+			{
+				Title:     "Hiking trip",
+				StartTime: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+				EndTime:   time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+				AllDay:    true,
+				Attendees: []string{"me@example.com", "ada@example.com"},
+			},
+			{
+				Title:     "All hands",
+				StartTime: testNow.AddDate(0, 0, -3),
+				EndTime:   testNow.AddDate(0, 0, -3).Add(time.Hour),
+				Attendees: []string{"me@example.com", "ada@work.example.com", "bob@example.com", "carol@example.com", "dave@example.com"},
+			},
+			{
+				Title:     "Dentist",
+				StartTime: testNow.Add(4 * time.Hour),
+				EndTime:   testNow.Add(5 * time.Hour),
+			},
+			{
+				Title:     "Lunch",
+				StartTime: testNow.AddDate(0, 0, 6).Add(3 * time.Hour),
+				EndTime:   testNow.AddDate(0, 0, 6).Add(4 * time.Hour),
+				Attendees: []string{"me@example.com", "Grace@Example.com", "stranger@example.com"},
+			},
+			{
+				Title:     "Conference",
+				StartTime: testNow.AddDate(0, 0, 8),
+				EndTime:   testNow.AddDate(0, 0, 9),
+				Attendees: []string{"me@example.com", "stranger@example.com"},
+			},
+			{
+				Title:     "Too far ahead",
+				StartTime: testNow.AddDate(0, 1, 0),
+				EndTime:   testNow.AddDate(0, 1, 0).Add(time.Hour),
+				Attendees: []string{"ada@example.com"},
+			},
+		},
+	}
+	feeds := &fake.Feeds{
+		Posts: map[string][]tools.BlogPost{
+			"https://ada.example.com/feed": {
+				{Title: "Notes on the Analytical Engine", Link: "https://ada.example.com/engine", Published: testNow.AddDate(0, 0, -2)},
+				{Title: "Poetical Science", Link: "https://ada.example.com/poetry", Published: testNow.AddDate(0, 0, -12)},
+				{Title: "An Old Post", Link: "https://ada.example.com/old", Published: testNow.AddDate(0, -3, 0)},
+			},
+		},
+	}
+
+	return &testEnv{
+		assistant: &SocialAssistant{
+			llm:       model,
+			mail:      mailbox,
+			calendar:  calendar,
+			scheduler: calendar,
+			feeds:     feeds,
+			contacts:  contacts,
+			days:      30,
+			ahead:     14,
+			top:       3,
+			now:       func() time.Time { return testNow },
+			in:        bufio.NewReader(strings.NewReader(input)),
+			out:       io.Discard,
+			ctx:       context.Background(),
+		},
+		llm:      model,
+		mailbox:  mailbox,
+		calendar: calendar,
+	}
+}
+
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("failed to update %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("prompt does not match %s (run go test -update to regenerate)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+const testRecommendations = `{"recommendations": [
+	{"email": "grace@example.com", "reason": "You're seeing Grace at lunch.", "action": "No need to reach out", "opener": ""},
+	{"email": "ada@work.example.com", "reason": "She's waiting on a reply.", "action": "Reply about the engine", "opener": "Sorry for the slow reply!"}
+]}`
+
+func TestGetSocialRecommendations(t *testing.T) {
+	env := newTestEnv("", testRecommendations)
+
+	got, err := env.assistant.GetSocialRecommendations()
+	if err != nil {
+		t.Fatalf("GetSocialRecommendations() error: %v", err)
+	}
+	if len(got) != 2 || got[0].Email != "ada@example.com" || got[0].Name != "Ada Lovelace" || got[1].Email != "grace@example.com" {
+		t.Errorf("GetSocialRecommendations() = %+v, want Ada then Grace in ranking order", got)
+	}
+	if len(env.llm.Prompts) != 1 {
+		t.Fatalf("got %d prompts, want 1", len(env.llm.Prompts))
+	}
+	assertGolden(t, "recommend_prompt", env.llm.Prompts[0])
+}
+
+func TestGetSocialRecommendationsRetriesInvalid(t *testing.T) {
+	env := newTestEnv("",
+		"Reach out to Grace.",
+		`{"recommendations": [{"email": "alan@example.com", "reason": "Why not?", "action": "Say hi", "opener": "Hi!"}]}`,
+		testRecommendations,
+	)
+
+	got, err := env.assistant.GetSocialRecommendations()
+	if err != nil {
+		t.Fatalf("GetSocialRecommendations() error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("GetSocialRecommendations() = %+v, want 2 recommendations", got)
+	}
+	if len(env.llm.Prompts) != 3 {
+		t.Fatalf("got %d prompts, want 3", len(env.llm.Prompts))
+	}
+	if !strings.Contains(env.llm.Prompts[1], "not valid JSON") {
+		t.Errorf("retry prompt does not explain the JSON error:\n%s", env.llm.Prompts[1])
+	}
+	if !strings.Contains(env.llm.Prompts[2], `"alan@example.com" is not one of my contacts`) {
+		t.Errorf("retry prompt does not explain the unknown contact:\n%s", env.llm.Prompts[2])
+	}
+}
+
+func TestGetSocialRecommendationsGivesUp(t *testing.T) {
+	env := newTestEnv("", "Reach out to Grace.", "Reach out to Ada.", "Reach out to both.")
+
+	if _, err := env.assistant.GetSocialRecommendations(); err == nil {
+		t.Fatal("GetSocialRecommendations() succeeded with no valid response")
+	}
+	if len(env.llm.Prompts) != maxJSONAttempts {
+		t.Errorf("got %d prompts, want %d", len(env.llm.Prompts), maxJSONAttempts)
+	}
+}
+
+func TestFormatRecommendations(t *testing.T) {
+	got := formatRecommendations([]Recommendation{
+		{Email: "ada@example.com", Name: "Ada Lovelace", Score: 72.5, Reason: "Waiting on\na reply.", Action: "Reply", Opener: "Hi Ada!"},
+		{Email: "grace@example.com", Name: "Grace Hopper", Score: -10, Reason: "Lunch soon.", Action: "No need to reach out"},
+	})
+	want := "#  CONTACT                           SCORE  REASON               ACTION                OPENER\n" +
+		"1  Ada Lovelace <ada@example.com>    72.5   Waiting on a reply.  Reply                 Hi Ada!\n" +
+		"2  Grace Hopper <grace@example.com>  -10.0  Lunch soon.          No need to reach out  \n"
+	if got != want {
+		t.Errorf("formatRecommendations() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDraftEmailWithFeedback(t *testing.T) {
+	env := newTestEnv("n\nMake it shorter\ny\n",
+		`{"subject": "Catching up", "body": "Hi Ada,\n\nLong draft.\n\nCheers,\nMe"}`,
+		`{"subject": "Quick hello", "body": "Hi Ada,\n\nShort draft.\n\nCheers,\nMe"}`,
+	)
+
+	result, err := env.assistant.DraftEmail("ada@example.com", DraftOptions{})
+	if err != nil {
+		t.Fatalf("DraftEmail() error: %v", err)
+	}
+	if !strings.HasPrefix(result, "Draft saved:\n\nSubject: Quick hello") {
+		t.Errorf("DraftEmail() = %q, want the saved draft", result)
+	}
+	if len(env.llm.Prompts) != 2 {
+		t.Fatalf("got %d prompts, want 2", len(env.llm.Prompts))
+	}
+	assertGolden(t, "draft_prompt", env.llm.Prompts[0])
+	assertGolden(t, "draft_feedback_prompt", env.llm.Prompts[1])
+
+	if len(env.mailbox.Drafts) != 1 {
+		t.Fatalf("got %d saved drafts, want 1", len(env.mailbox.Drafts))
+	}
+	draft := env.mailbox.Drafts[0]
+	if draft.To != "ada@example.com" || draft.Subject != "Quick hello" {
+		t.Errorf("saved draft = %+v, want approved second draft to ada@example.com", draft)
+	}
+}
+
+func TestDraftEmailReplyInThread(t *testing.T) {
+	env := newTestEnv("y\ny\n", `{"subject": "Catching up", "body": "Hi Ada,\nFollowing up.\nMe"}`)
+	env.mailbox.Threads = map[string]tools.Thread{
+		"ada@example.com": {
+			ID:         "thread-1",
+			Subject:    "Engine plans",
+			MessageID:  "<msg-2@example.com>",
+			References: "<msg-1@example.com>",
+			Date:       testNow.AddDate(0, 0, -2),
+		},
+	}
+
+	if _, err := env.assistant.DraftEmail("ada@example.com", DraftOptions{}); err != nil {
+		t.Fatalf("DraftEmail() error: %v", err)
+	}
+	if !strings.Contains(env.llm.Prompts[0], `reply in our existing thread "Engine plans"`) {
+		t.Errorf("prompt does not mention the thread being replied to:\n%s", env.llm.Prompts[0])
+	}
+
+	if len(env.mailbox.Drafts) != 1 {
+		t.Fatalf("got %d saved drafts, want 1", len(env.mailbox.Drafts))
+	}
+	want := tools.DraftEmail{
+		Subject:    "Re: Engine plans",
+		Body:       "Hi Ada,\nFollowing up.\nMe",
+		To:         "ada@example.com",
+		ThreadID:   "thread-1",
+		InReplyTo:  "<msg-2@example.com>",
+		References: "<msg-1@example.com> <msg-2@example.com>",
+	}
+	if got := env.mailbox.Drafts[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved draft = %+v, want %+v", got, want)
+	}
+}
+
+func TestDraftEmailRepromptsInvalidDraft(t *testing.T) {
+	env := newTestEnv("y\n",
+		"**Subject:** Catching up\nHi Ada,\nMe",
+		`{"subject": "", "body": "Hi Ada,\nMe"}`,
+		`{"subject": "Catching up", "body": "Hi Ada,\n\nMe", "cc": ["Grace Hopper <grace@example.com>", "Bob@Example.com"]}`,
+	)
+
+	_, err := env.assistant.DraftEmail("ada@example.com", DraftOptions{Cc: []string{"bob@example.com"}})
+	if err != nil {
+		t.Fatalf("DraftEmail() error: %v", err)
+	}
+	if len(env.llm.Prompts) != 3 {
+		t.Fatalf("got %d prompts, want 3", len(env.llm.Prompts))
+	}
+	if !strings.Contains(env.llm.Prompts[2], "the subject is empty") {
+		t.Errorf("retry prompt does not explain the error:\n%s", env.llm.Prompts[2])
+	}
+
+	if len(env.mailbox.Drafts) != 1 {
+		t.Fatalf("got %d saved drafts, want 1", len(env.mailbox.Drafts))
+	}
+	draft := env.mailbox.Drafts[0]
+	if draft.Subject != "Catching up" || draft.Body != "Hi Ada,\n\nMe" {
+		t.Errorf("saved draft = %+v, want the third response", draft)
+	}
+	if want := []string{"bob@example.com", "grace@example.com"}; !reflect.DeepEqual(draft.Cc, want) {
+		t.Errorf("saved draft Cc = %v, want %v", draft.Cc, want)
+	}
+}
+
+func TestCatchupWithBlogAlias(t *testing.T) {
+	env := newTestEnv("", "Summary.")
+
+	if _, err := env.assistant.CatchupWithBlog("ADA@work.example.com"); err != nil {
+		t.Fatalf("CatchupWithBlog() error for an alias: %v", err)
+	}
+}
+
+func TestDraftEmailUnknownContact(t *testing.T) {
+	env := newTestEnv("")
+
+	if _, err := env.assistant.DraftEmail("stranger@example.com", DraftOptions{}); err == nil {
+		t.Fatal("DraftEmail() succeeded for a contact not in the contacts list")
+	}
+	if len(env.llm.Prompts) != 0 {
+		t.Errorf("got %d prompts, want none", len(env.llm.Prompts))
+	}
+}
+
+func TestCatchupWithBlog(t *testing.T) {
+	env := newTestEnv("", "Ada has been writing about engines.")
+
+	got, err := env.assistant.CatchupWithBlog("ada@example.com")
+	if err != nil {
+		t.Fatalf("CatchupWithBlog() error: %v", err)
+	}
+	if got != "Ada has been writing about engines." {
+		t.Errorf("CatchupWithBlog() = %q, want scripted response", got)
+	}
+	assertGolden(t, "catchup_prompt", env.llm.Prompts[0])
+}
+
+func TestCatchupWithBlogNoFeed(t *testing.T) {
+	env := newTestEnv("")
+
+	if _, err := env.assistant.CatchupWithBlog("grace@example.com"); err == nil {
+		t.Fatal("CatchupWithBlog() succeeded for a contact without a feed")
+	}
+}
+
+func TestScheduleCatchup(t *testing.T) {
+	env := newTestEnv("2\ny\n")
+	var out strings.Builder
+	env.assistant.out = &out
+
+	result, err := env.assistant.ScheduleCatchup("ada@work.example.com", ScheduleOptions{
+		Duration: 30 * time.Minute,
+		Hours:    tools.DefaultWorkingHours,
+		Slots:    3,
+	})
+	if err != nil {
+		t.Fatalf("ScheduleCatchup() error: %v", err)
+	}
+
+	// Working hours overlap from 13:00 to 17:00 UTC while Ada is on EDT; the
+	// dentist blocks Friday until 14:00 and the weekend is skipped.
+	for _, want := range []string{
+		"1. Friday 2024-03-15 14:00-14:30 UTC (Friday 2024-03-15 10:00-10:30 EDT for Ada Lovelace)",
+		"2. Monday 2024-03-18 13:00-13:30 UTC",
+		"3. Tuesday 2024-03-19 13:00-13:30 UTC",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not propose %q:\n%s", want, out.String())
+		}
+	}
+
+	if len(env.calendar.Holds) != 1 {
+		t.Fatalf("got %d holds, want 1", len(env.calendar.Holds))
+	}
+	hold := env.calendar.Holds[0]
+	wantStart := time.Date(2024, 3, 18, 13, 0, 0, 0, time.UTC)
+	if !hold.Slot.Start.Equal(wantStart) || hold.Slot.End.Sub(hold.Slot.Start) != 30*time.Minute {
+		t.Errorf("hold slot = %+v, want 30 minutes from %v", hold.Slot, wantStart)
+	}
+	if hold.Title != "Catch up with Ada Lovelace" || !reflect.DeepEqual(hold.Invite, []string{"ada@example.com"}) {
+		t.Errorf("hold = %+v", hold)
+	}
+	if !strings.Contains(result, "invitation sent to ada@example.com") {
+		t.Errorf("result = %q", result)
+	}
+}
+
+func TestScheduleCatchupCancelled(t *testing.T) {
+	env := newTestEnv("\n")
+	result, err := env.assistant.ScheduleCatchup("grace@example.com", ScheduleOptions{
+		Duration: time.Hour,
+		Hours:    tools.DefaultWorkingHours,
+		Slots:    3,
+	})
+	if err != nil {
+		t.Fatalf("ScheduleCatchup() error: %v", err)
+	}
+	if len(env.calendar.Holds) != 0 {
+		t.Errorf("got %d holds after cancelling, want 0", len(env.calendar.Holds))
+	}
+	if !strings.Contains(result, "nothing was scheduled") {
+		t.Errorf("result = %q", result)
+	}
+}
+
+func TestGetSocialRecommendationsTopN(t *testing.T) {
+	env := newTestEnv("", `{"recommendations": [{"email": "ada@example.com", "reason": "Overdue.", "action": "Email her", "opener": "Hi Ada"}]}`)
+	env.assistant.top = 1
+
+	if _, err := env.assistant.GetSocialRecommendations(); err != nil {
+		t.Fatalf("GetSocialRecommendations() error: %v", err)
+	}
+	prompt := env.llm.Prompts[0]
+	if !strings.Contains(prompt, "1. Ada Lovelace") || strings.Contains(prompt, "Grace") {
+		t.Errorf("prompt should only cover the top contact:\n%s", prompt)
+	}
+}
+
+func TestGetSocialRecommendationsNegativeTop(t *testing.T) {
+	env := newTestEnv("", `{"recommendations": [{"email": "ada@example.com", "reason": "Overdue.", "action": "Email her", "opener": "Hi Ada"}]}`)
+	env.assistant.top = -1
+
+	got, err := env.assistant.GetSocialRecommendations()
+	if err != nil {
+		t.Fatalf("GetSocialRecommendations() error: %v", err)
+	}
+	if len(got) != 1 || got[0].Email != "ada@example.com" {
+		t.Errorf("GetSocialRecommendations() = %+v, want only the top contact", got)
+	}
+}
+
+func TestRankContacts(t *testing.T) {
+	env := newTestEnv("")
+	scores, err := env.assistant.RankContacts()
+	if err != nil {
+		t.Fatalf("RankContacts() error: %v", err)
+	}
+	if len(scores) != 2 || scores[0].Contact.Email != "ada@example.com" || scores[1].Contact.Email != "grace@example.com" {
+		t.Fatalf("RankContacts() = %+v, want Ada then Grace", scores)
+	}
+	if len(env.llm.Prompts) != 0 {
+		t.Errorf("RankContacts() sent %d prompts to the LLM, want 0", len(env.llm.Prompts))
+	}
+}
+
+func TestOverdueContacts(t *testing.T) {
+	env := newTestEnv("")
+	contacts := append([]config.Contact{}, testContacts...)
+	contacts[1].Cadence = "every 3 days"
+	contacts = append(contacts,
+		config.Contact{Email: "alan@example.com", Name: "Alan Turing", Priority: 2, Cadence: "yearly"},
+		config.Contact{Email: "charles@example.com", Name: "Charles Babbage", Priority: 1, Cadence: "every 200 days"})
+	env.assistant.contacts = config.NewIdentities(contacts, testAddressOptions)
+	env.mailbox.Identities = env.assistant.contacts
+
+	overdue, days, err := env.assistant.OverdueContacts()
+	if err != nil {
+		t.Fatalf("OverdueContacts() error: %v", err)
+	}
+	if days != maxOverdueDays {
+		t.Errorf("history window = %d days, want a yearly cadence capped at %d", days, maxOverdueDays)
+	}
+
+	// Alan's cadence is as long as the window, so he can't be known to be
+	// overdue.
+	want := "- Charles Babbage (charles@example.com): at least 165 days overdue (cadence: every 200 days, no contact in the last 365 days)\n" +
+		"- Grace Hopper (grace@example.com): 2 days overdue (cadence: every 3 days, last contact 2024-03-10)\n"
+	if got := formatOverdue(overdue, days); got != want {
+		t.Errorf("formatOverdue() =\n%s\nwant:\n%s", got, want)
+	}
+	if len(env.llm.Prompts) != 0 {
+		t.Errorf("OverdueContacts() sent %d prompts to the LLM, want 0", len(env.llm.Prompts))
+	}
+}
+
+func TestRunAgent(t *testing.T) {
+	env := newTestEnv("", "Write to Ada.")
+	env.assistant.steps = 3
+	env.assistant.verbose = true
+	var transcript strings.Builder
+	env.assistant.out = &transcript
+	env.llm.ToolCalls = [][]fake.ToolCall{
+		{
+			{Name: "search_mail", Args: `{"email": "ada@work.example.com", "days": 7}`},
+			{Name: "list_events", Args: `{"from": "2024-03-12", "to": "2024-03-21"}`},
+		},
+		{
+			{Name: "fetch_feed", Args: `{"email": "grace@example.com"}`},
+			{Name: "send_email", Args: `{}`},
+		},
+	}
+
+	got, err := env.assistant.RunAgent(DefaultQuestion)
+	if err != nil {
+		t.Fatalf("RunAgent() error: %v", err)
+	}
+	if got != "Write to Ada." {
+		t.Errorf("RunAgent() = %q, want scripted response", got)
+	}
+	assertGolden(t, "agent_prompt", env.llm.Prompts[0])
+
+	want := []string{
+		`{"contact":"ada@example.com","days":7,"emails":3,"received":2,"sent":1,"last_received":"2024-03-12","last_sent":"2024-03-13","awaiting_my_reply":false}`,
+		`[{"title":"All hands","start":"2024-03-12T09:00:00Z","end":"2024-03-12T10:00:00Z","attendees":["me@example.com","Ada Lovelace (ada@example.com)","bob@example.com","carol@example.com","dave@example.com"]},` +
+			`{"title":"Dentist","start":"2024-03-15T13:00:00Z","end":"2024-03-15T14:00:00Z"},` +
+			`{"title":"Lunch","start":"2024-03-21T12:00:00Z","end":"2024-03-21T13:00:00Z","attendees":["me@example.com","Grace Hopper (grace@example.com)","stranger@example.com"]}]`,
+		`{"error":"grace@example.com has no feed"}`,
+		`{"error":"unknown tool send_email"}`,
+	}
+	if !reflect.DeepEqual(env.llm.ToolResults, want) {
+		t.Errorf("tool results =\n%s\nwant:\n%s", strings.Join(env.llm.ToolResults, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.Contains(transcript.String(), `-> search_mail {"email": "ada@work.example.com", "days": 7}`) ||
+		!strings.Contains(transcript.String(), "<- fetch_feed failed: grace@example.com has no feed") {
+		t.Errorf("transcript is missing tool calls:\n%s", transcript.String())
+	}
+}
+
+func TestSearchMailDaysLimit(t *testing.T) {
+	env := newTestEnv("")
+	args := json.RawMessage(`{"email": "ada@example.com", "days": 100000}`)
+	if _, err := env.assistant.searchMail(context.Background(), args); err == nil || !strings.Contains(err.Error(), "at most 365") {
+		t.Errorf("searchMail() with 100000 days = %v, want a limit error", err)
+	}
+	args = json.RawMessage(`{"email": "ada@example.com", "days": 365}`)
+	if _, err := env.assistant.searchMail(context.Background(), args); err != nil {
+		t.Errorf("searchMail() with 365 days error: %v", err)
+	}
+}
+
+func TestRunAgentStepLimit(t *testing.T) {
+	env := newTestEnv("", "Done.")
+	env.assistant.steps = 1
+	env.llm.ToolCalls = [][]fake.ToolCall{
+		{{Name: "fetch_feed", Args: `{"email": "ada@example.com"}`}},
+		{{Name: "fetch_feed", Args: `{"email": "ada@example.com"}`}},
+	}
+
+	if _, err := env.assistant.RunAgent(DefaultQuestion); err == nil {
+		t.Fatal("RunAgent() succeeded past the step limit")
+	}
+	if len(env.llm.ToolResults) != 1 {
+		t.Errorf("got %d tool calls, want 1", len(env.llm.ToolResults))
+	}
+}
+
+func TestChatLoop(t *testing.T) {
+	env := newTestEnv("Hi\n/contacts\n/catchup ada@example.com\n/bogus\nWhat is new with Ada?\n/quit\nIgnored\n",
+		"Hello!", "Ada wrote about the engine.", "She has notes on the Analytical Engine.")
+	var out strings.Builder
+	env.assistant.out = &out
+
+	if err := env.assistant.ChatLoop(); err != nil {
+		t.Fatalf("ChatLoop() error: %v", err)
+	}
+	assertGolden(t, "chat_context", env.llm.System)
+
+	want := []string{
+		"Hi", "Hello!",
+		"I ran /contacts and got:", formatContacts(testContacts),
+		"I ran /catchup ada@example.com and got:", "Ada wrote about the engine.",
+		"What is new with Ada?", "She has notes on the Analytical Engine.",
+	}
+	if !reflect.DeepEqual(env.llm.History, want) {
+		t.Errorf("conversation history = %q, want %q", env.llm.History, want)
+	}
+	if !strings.Contains(out.String(), "unknown command /bogus") {
+		t.Errorf("output does not report the unknown command:\n%s", out.String())
+	}
+}
+
+func TestChatReaderInterrupt(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	reader := &chatReader{in: bufio.NewReader(r)}
+
+	interrupts := make(chan os.Signal, 1)
+	interrupts <- os.Interrupt
+	if _, ok := reader.next(interrupts); ok {
+		t.Fatal("next() returned a line despite the interrupt")
+	}
+
+	go w.Write([]byte("Hello\n"))
+	input, ok := reader.next(nil)
+	if !ok || input.line != "Hello\n" || input.err != nil {
+		t.Errorf("next() = %+v, %v; want the line typed after the interrupt", input, ok)
+	}
+}
+
+func TestStreamCatchup(t *testing.T) {
+	env := newTestEnv("", "Ada wrote about the engine.")
+	var streamed strings.Builder
+	env.assistant.stream = &streamed
+
+	summary, err := env.assistant.CatchupWithBlog("ada@example.com")
+	if err != nil {
+		t.Fatalf("CatchupWithBlog() error: %v", err)
+	}
+	if summary != "Ada wrote about the engine." {
+		t.Errorf("CatchupWithBlog() = %q, want the full response", summary)
+	}
+	if streamed.String() != summary+"\n" {
+		t.Errorf("streamed %q, want %q", streamed.String(), summary+"\n")
+	}
+}
+
+func TestStreamChat(t *testing.T) {
+	env := newTestEnv("Hi\n/catchup ada@example.com\n", "Hello there!", "Ada wrote about the engine.")
+	var out strings.Builder
+	env.assistant.out = &out
+	env.assistant.stream = &out
+
+	if err := env.assistant.ChatLoop(); err != nil {
+		t.Fatalf("ChatLoop() error: %v", err)
+	}
+	// Replies are streamed once, and command results printed once.
+	for _, reply := range []string{"Hello there!", "Ada wrote about the engine."} {
+		if n := strings.Count(out.String(), reply); n != 1 {
+			t.Errorf("output shows %q %d times, want once:\n%s", reply, n, out.String())
+		}
+	}
+}
+
+func TestCatchupCancelled(t *testing.T) {
+	env := newTestEnv("", "Ada wrote about the engine.")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	env.assistant.ctx = ctx
+
+	if _, err := env.assistant.CatchupWithBlog("ada@example.com"); err != context.Canceled {
+		t.Errorf("CatchupWithBlog() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDraftEmailAfterBlockedResponse(t *testing.T) {
+	env := newTestEnv("c\nKeep it short\ny\n", "", `{"subject": "Hi", "body": "Hi Ada,\nMe"}`)
+	env.llm.Errors = []error{&llm.ResponseError{Err: llm.ErrBlocked, Reason: "Safety"}}
+
+	if _, err := env.assistant.DraftEmail("ada@example.com", DraftOptions{}); err != nil {
+		t.Fatalf("DraftEmail() error: %v", err)
+	}
+	if len(env.llm.Prompts) != 2 || !strings.Contains(env.llm.Prompts[1], "Keep it short") {
+		t.Errorf("second prompt does not include the changed request:\n%v", env.llm.Prompts)
+	}
+	if len(env.mailbox.Drafts) != 1 {
+		t.Errorf("got %d saved drafts, want 1", len(env.mailbox.Drafts))
+	}
+}
+
+func TestDraftEmailGiveUpAfterMaxTokens(t *testing.T) {
+	env := newTestEnv("q\n", "")
+	env.llm.Errors = []error{&llm.ResponseError{Err: llm.ErrMaxTokens, Reason: "MaxTokens"}}
+
+	_, err := env.assistant.DraftEmail("ada@example.com", DraftOptions{})
+	if !errors.Is(err, llm.ErrMaxTokens) {
+		t.Errorf("DraftEmail() error = %v, want %v", err, llm.ErrMaxTokens)
+	}
+}
@@ -0,0 +1,276 @@
+// Package retry runs outbound API calls with a deadline, retrying them with
+// exponential backoff and jitter when they fail in a way that may clear up.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+)
+
+// Policy says how many times and how patiently to try a call.
+type Policy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+
+	// Timeout is the deadline for each attempt; zero means none.
+	Timeout time.Duration
+}
+
+// Default is the policy used by Do and DoWrite. main sets its Timeout from
+// the -timeout flag.
+var Default = Policy{
+	MaxAttempts:  6,
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     30 * time.Second,
+	Timeout:      2 * time.Minute,
+}
+
+// maxRetryAfter is the longest a server may ask us to wait before we give
+// up instead of retrying.
+const maxRetryAfter = 5 * time.Minute
+
+// Do runs fn with the default policy.
+func Do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	return Default.Do(ctx, op, fn)
+}
+
+// DoWrite runs fn with the default policy, for calls that change something.
+func DoWrite(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	return Default.DoWrite(ctx, op, fn)
+}
+
+// Do runs fn, passing it a context with the policy's deadline, and retries
+// it while it fails with an error that Retryable accepts.
+func (p Policy) Do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	return p.run(ctx, op, fn, Retryable)
+}
+
+// DoWrite is like Do for calls such as creating a draft, which must not be
+// repeated if they might have taken effect. They are only retried when the
+// server turned them away for exceeding a rate limit.
+func (p Policy) DoWrite(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	return p.run(ctx, op, fn, RateLimited)
+}
+
+func (p Policy) run(ctx context.Context, op string, fn func(ctx context.Context) error, retryable func(error) bool) error {
+	delay := p.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := p.attempt(ctx, fn)
+		if permanent, ok := err.(*permanentError); ok {
+			return permanent.err
+		}
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		wait := delay / 2
+		if delay > 0 {
+			wait += time.Duration(rand.Int63n(int64(delay)))
+		}
+		if after, ok := RetryAfter(err); ok {
+			if after > maxRetryAfter {
+				return fmt.Errorf("%v (server asked to retry after %v)", err, after.Round(time.Second))
+			}
+			wait = after
+		}
+		glog.V(1).Infof("%s: attempt %d failed, retrying in %v: %v", op, attempt, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
+
+func (p Policy) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.Timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// permanentError marks an error that must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err so that it is returned without retrying, for example
+// because part of a streamed response has already been shown.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Retryable reports whether a call that failed with err may succeed if it is
+// tried again: it hit a rate limit, a transient server error, a dropped
+// connection or its own deadline.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if RateLimited(err) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return TransientStatus(statusErr.StatusCode)
+	}
+	if apiErr, ok := apierror.FromError(err); ok {
+		if code := apiErr.HTTPCode(); code != -1 {
+			return TransientStatus(code)
+		}
+		switch apiErr.GRPCStatus().Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Internal:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// RateLimited reports whether err says the call was rejected for exceeding
+// a rate limit or quota, so it certainly had no effect.
+func RateLimited(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		switch googleErr.Code {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusForbidden:
+			for _, e := range googleErr.Errors {
+				if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if apiErr, ok := apierror.FromError(err); ok {
+		return apiErr.GRPCStatus().Code() == codes.ResourceExhausted
+	}
+	return false
+}
+
+// TransientStatus reports whether an HTTP status code means the request may
+// succeed if it is sent again.
+func TransientStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RetryAfter returns how long the server that returned err asked us to wait
+// before trying again, if it said.
+func RetryAfter(err error) (time.Duration, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter, statusErr.RetryAfter > 0
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		if after, ok := parseRetryAfter(googleErr.Header.Get("Retry-After")); ok {
+			return after, true
+		}
+	}
+	if apiErr, ok := apierror.FromError(err); ok {
+		if info := apiErr.Details().RetryInfo; info != nil && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0), true
+	}
+	return 0, false
+}
+
+// StatusError is returned for an HTTP response whose status means the
+// request failed.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%s returned %s", e.URL, e.Status)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// CheckResponse returns a StatusError unless resp has a 2xx status. The
+// error includes the start of the response body, which it closes.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	err := &StatusError{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       strings.TrimSpace(string(body)),
+	}
+	err.RetryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"))
+	return err
+}
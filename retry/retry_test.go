@@ -0,0 +1,137 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+var quick = Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+func status(code int) error {
+	return &StatusError{URL: "https://example.com", StatusCode: code, Status: http.StatusText(code)}
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name  string
+		write bool
+		errs  []error
+		calls int
+		ok    bool
+	}{
+		{"succeeds", false, nil, 1, true},
+		{"retries unavailable", false, []error{status(503), status(503)}, 3, true},
+		{"gives up after max attempts", false, []error{status(503), status(503), status(503)}, 3, false},
+		{"does not retry not found", false, []error{status(404)}, 1, false},
+		{"does not retry permanent", false, []error{Permanent(status(503))}, 1, false},
+		{"retries Google rate limit", false, []error{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}}, 2, true},
+		{"does not retry Google forbidden", false, []error{&googleapi.Error{Code: 403}}, 1, false},
+		{"retries wrapped deadline", false, []error{fmt.Errorf("get: %w", context.DeadlineExceeded)}, 2, true},
+		{"write retries rate limit", true, []error{status(429)}, 2, true},
+		{"write does not retry unavailable", true, []error{status(503)}, 1, false},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		fn := func(ctx context.Context) error {
+			calls++
+			if calls <= len(tt.errs) {
+				return tt.errs[calls-1]
+			}
+			return nil
+		}
+		var err error
+		if tt.write {
+			err = quick.DoWrite(context.Background(), tt.name, fn)
+		} else {
+			err = quick.Do(context.Background(), tt.name, fn)
+		}
+		if calls != tt.calls || (err == nil) != tt.ok {
+			t.Errorf("%s: %d calls, error %v; want %d calls, ok %v", tt.name, calls, err, tt.calls, tt.ok)
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			t.Errorf("%s: returned a permanent marker: %v", tt.name, err)
+		}
+	}
+}
+
+func TestDoTimesOutEachAttempt(t *testing.T) {
+	policy := quick
+	policy.Timeout = 10 * time.Millisecond
+
+	calls := 0
+	err := policy.Do(context.Background(), "hang", func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || calls != 3 {
+		t.Errorf("Do = %v after %d calls, want deadline exceeded after 3", err, calls)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := quick.Do(ctx, "cancel", func(ctx context.Context) error {
+		calls++
+		cancel()
+		return status(503)
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want an error after 1", err, calls)
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckResponse(resp)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests || statusErr.Body != "slow down" {
+		t.Fatalf("CheckResponse = %#v, want a 429 StatusError", err)
+	}
+	if after, ok := RetryAfter(err); !ok || after != 7*time.Second {
+		t.Errorf("RetryAfter = %v, %v; want 7s", after, ok)
+	}
+	if !Retryable(err) || !RateLimited(err) {
+		t.Errorf("%v should be retryable and rate limited", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package scoring
+
+import (
+	"sort"
+	"time"
+
+	"socialbot/config"
+)
+
+// OverdueContact is a contact I haven't been in touch with as often as their
+// cadence asks.
+type OverdueContact struct {
+	Contact config.Contact
+	Cadence time.Duration
+
+	// LastContact is the latest email or meeting with the contact, or zero
+	// if there was none in the history window.
+	LastContact time.Time
+
+	// Overdue is how long ago the next contact was due. With no contact in
+	// the history window it is measured from the start of the window, so it
+	// is a lower bound.
+	Overdue time.Duration
+}
+
+// Overdue returns the contacts whose latest email or meeting is further back
+// than their cadence, most overdue first. Only Contacts, Interactions, Now and
+// Days are used.
+func Overdue(in Input) []OverdueContact {
+	lastContact := make(map[string]time.Time)
+	for _, interaction := range in.Interactions {
+		lastContact[interaction.Participant] = interaction.LastContact
+	}
+	windowStart := in.Now.AddDate(0, 0, -in.Days)
+
+	var result []OverdueContact
+	for _, contact := range in.Contacts.Contacts() {
+		cadence := Cadence(contact)
+		last := lastContact[contact.Email]
+
+		since := last
+		if since.IsZero() {
+			since = windowStart
+		}
+		overdue := in.Now.Sub(since.Add(cadence))
+		if overdue <= 0 {
+			continue
+		}
+
+		result = append(result, OverdueContact{
+			Contact:     contact,
+			Cadence:     cadence,
+			LastContact: last,
+			Overdue:     overdue,
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Overdue != result[j].Overdue {
+			return result[i].Overdue > result[j].Overdue
+		}
+		if result[i].Contact.Priority != result[j].Contact.Priority {
+			return result[i].Contact.Priority > result[j].Contact.Priority
+		}
+		return result[i].Contact.Email < result[j].Contact.Email
+	})
+	return result
+}
+
+// LongestCadence returns the longest cadence among contacts, which is how
+// far back history must go to tell whether every contact is overdue.
+func LongestCadence(contacts []config.Contact) time.Duration {
+	var longest time.Duration
+	for _, contact := range contacts {
+		if cadence := Cadence(contact); cadence > longest {
+			longest = cadence
+		}
+	}
+	return longest
+}
@@ -0,0 +1,184 @@
+// Package scoring ranks contacts by how much they need a message from me,
+// keeping the reasons behind every score so the ranking can be audited.
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"socialbot/config"
+	"socialbot/tools"
+)
+
+// Points awarded or deducted for each factor.
+const (
+	pointsPerPriority = 10.0
+
+	// overduePoints is awarded per cadence interval since the last contact,
+	// up to maxOverdueIntervals intervals.
+	overduePoints       = 30.0
+	maxOverdueIntervals = 3.0
+
+	// infrequentPoints is awarded in full when there was no contact in the
+	// history window, scaled down as interactions approach the cadence.
+	infrequentPoints = 15.0
+
+	awaitingReplyPoints = 25.0
+	upcomingEventPoints = -50.0
+)
+
+// Reason is one factor contributing to a score.
+type Reason struct {
+	Points float64
+	Text   string
+}
+
+func (r Reason) String() string {
+	return fmt.Sprintf("%s (%+.1f)", r.Text, r.Points)
+}
+
+// Score is a contact's ranking score and how it was reached.
+type Score struct {
+	Contact config.Contact
+	Total   float64
+	Reasons []Reason
+
+	// Interaction summarizes email and meetings with the contact over the
+	// history window; it is zero if there were none.
+	Interaction tools.EmailInteraction
+
+	// NextEvent is the next upcoming event with the contact, if any.
+	NextEvent *tools.Event
+}
+
+func (s *Score) add(points float64, format string, args ...interface{}) {
+	s.Total += points
+	s.Reasons = append(s.Reasons, Reason{Points: points, Text: fmt.Sprintf(format, args...)})
+}
+
+// Input is everything a ranking is computed from.
+type Input struct {
+	Now time.Time
+
+	// Days is the length of the history window Interactions cover.
+	Days int
+
+	Contacts     *config.Identities
+	Interactions []tools.EmailInteraction
+
+	// Upcoming lists events between Now and the end of the look-ahead
+	// window.
+	Upcoming []tools.Event
+}
+
+// DefaultCadence is how often I aim to be in touch with a contact of the
+// given priority when they have no cadence of their own.
+func DefaultCadence(priority int) time.Duration {
+	days := map[int]int{5: 7, 4: 14, 3: 30, 2: 90, 1: 180}[priority]
+	if days == 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Cadence is how often I aim to be in touch with contact.
+func Cadence(contact config.Contact) time.Duration {
+	if d, ok := contact.CadenceInterval(); ok {
+		return d
+	}
+	return DefaultCadence(contact.Priority)
+}
+
+// DescribeCadence formats a contact's cadence as configured, or in days if
+// it comes from their priority.
+func DescribeCadence(contact config.Contact) string {
+	if _, ok := contact.CadenceInterval(); ok {
+		return contact.Cadence
+	}
+	return fmt.Sprintf("every %.0f days", days(Cadence(contact)))
+}
+
+// Rank scores every contact and returns them highest score first.
+func Rank(in Input) []Score {
+	interactions := make(map[string]tools.EmailInteraction)
+	for _, interaction := range in.Interactions {
+		interactions[interaction.Participant] = interaction
+	}
+	nextEvents := nextEventByContact(in.Upcoming, in.Contacts)
+
+	var scores []Score
+	for _, contact := range in.Contacts.Contacts() {
+		score := Score{
+			Contact:     contact,
+			Interaction: interactions[contact.Email],
+			NextEvent:   nextEvents[contact.Email],
+		}
+		score.rate(in)
+		scores = append(scores, score)
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Total != scores[j].Total {
+			return scores[i].Total > scores[j].Total
+		}
+		if scores[i].Contact.Priority != scores[j].Contact.Priority {
+			return scores[i].Contact.Priority > scores[j].Contact.Priority
+		}
+		return scores[i].Contact.Email < scores[j].Contact.Email
+	})
+	return scores
+}
+
+func (s *Score) rate(in Input) {
+	contact := s.Contact
+	interaction := s.Interaction
+	cadenceDays := days(Cadence(contact))
+
+	s.add(pointsPerPriority*float64(contact.Priority), "priority %d of 5", contact.Priority)
+
+	if interaction.LastContact.IsZero() {
+		intervals := math.Min(float64(in.Days)/cadenceDays, maxOverdueIntervals)
+		s.add(overduePoints*intervals, "no contact in the last %d days (cadence: %s)", in.Days, DescribeCadence(contact))
+	} else {
+		since := days(in.Now.Sub(interaction.LastContact))
+		intervals := math.Min(since/cadenceDays, maxOverdueIntervals)
+		s.add(overduePoints*intervals, "last contact %.0f days ago on %s (cadence: %s)", since, interaction.LastContact.Format("2006-01-02"), DescribeCadence(contact))
+	}
+
+	expected := float64(in.Days) / cadenceDays
+	actual := float64(interaction.Count) + interaction.MeetingWeight
+	if expected > 0 && actual < expected {
+		s.add(infrequentPoints*(expected-actual)/expected, "%.1f interactions in the last %d days, expected about %.0f", actual, in.Days, math.Ceil(expected))
+	}
+
+	if interaction.AwaitingReply() {
+		s.add(awaitingReplyPoints, "waiting on my reply since %s", interaction.LastReceived.Format("2006-01-02"))
+	}
+
+	if s.NextEvent != nil {
+		s.add(upcomingEventPoints, "already seeing them on %s (%s)", s.NextEvent.StartTime.Format("Monday 2006-01-02"), s.NextEvent.Title)
+	}
+}
+
+func nextEventByContact(events []tools.Event, contacts *config.Identities) map[string]*tools.Event {
+	next := make(map[string]*tools.Event)
+	for i := range events {
+		event := &events[i]
+		for _, attendee := range event.Attendees {
+			contact := contacts.Resolve(attendee)
+			if contact == nil {
+				continue
+			}
+			if current, ok := next[contact.Email]; !ok || event.StartTime.Before(current.StartTime) {
+				next[contact.Email] = event
+			}
+		}
+	}
+	return next
+}
+
+func days(d time.Duration) float64 {
+	return d.Hours() / 24
+}
@@ -0,0 +1,65 @@
+package scoring
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"socialbot/config"
+	"socialbot/tools"
+)
+
+func TestRank(t *testing.T) {
+	now := time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC)
+	contacts := config.NewIdentities([]config.Contact{
+		{Email: "ada@example.com", Name: "Ada", Priority: 5},
+		{Email: "grace@example.com", Name: "Grace", Priority: 3},
+		{Email: "alan@example.com", Name: "Alan", Priority: 2},
+	}, config.AddressOptions{})
+
+	scores := Rank(Input{
+		Now:      now,
+		Days:     30,
+		Contacts: contacts,
+		Interactions: []tools.EmailInteraction{
+			{Participant: "ada@example.com", LastContact: now.AddDate(0, 0, -14), Count: 1, ReceivedCount: 1, LastReceived: now.AddDate(0, 0, -14)},
+			{Participant: "grace@example.com", LastContact: now.AddDate(0, 0, -1), Count: 3, MeetingWeight: 1},
+		},
+		Upcoming: []tools.Event{
+			{Title: "Lunch", StartTime: now.AddDate(0, 0, 3), Attendees: []string{"Grace@Example.com"}},
+		},
+	})
+
+	var order []string
+	for _, score := range scores {
+		order = append(order, score.Contact.Name)
+	}
+	if got := strings.Join(order, ","); got != "Ada,Alan,Grace" {
+		t.Fatalf("Rank order = %s, want Ada,Alan,Grace", got)
+	}
+
+	// Ada: priority 50, two cadence intervals overdue 60, one of about five
+	// expected interactions 15*(30/7-1)/(30/7), and a reply owed 25.
+	ada := scores[0]
+	if want := 50 + 60 + 15*(30.0/7-1)/(30.0/7) + 25; ada.Total < want-0.01 || ada.Total > want+0.01 {
+		t.Errorf("Ada total = %v, want %v; reasons %v", ada.Total, want, ada.Reasons)
+	}
+	if len(ada.Reasons) != 4 {
+		t.Errorf("Ada reasons = %v, want 4", ada.Reasons)
+	}
+
+	// Alan has no interactions at all.
+	alan := scores[1]
+	if !strings.Contains(alan.Reasons[1].Text, "no contact in the last 30 days") {
+		t.Errorf("Alan reasons = %v", alan.Reasons)
+	}
+
+	grace := scores[2]
+	if grace.NextEvent == nil || grace.NextEvent.Title != "Lunch" {
+		t.Errorf("Grace next event = %v, want Lunch", grace.NextEvent)
+	}
+	last := grace.Reasons[len(grace.Reasons)-1]
+	if last.Points != upcomingEventPoints || !strings.Contains(last.Text, "already seeing them on Monday 2024-03-18") {
+		t.Errorf("Grace's last reason = %v", last)
+	}
+}
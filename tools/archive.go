@@ -0,0 +1,224 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ImportMailArchive reads the interaction headers of every message in an
+// mbox file or Maildir directory. Messages are marked as sent when they carry
+// Gmail's "Sent" label, live in a folder named like "Sent", or are from one
+// of the addresses in me.
+func ImportMailArchive(path string, me []string) ([]Message, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %v", err)
+	}
+	if info.IsDir() {
+		return ImportMaildir(path, me)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %v", err)
+	}
+	defer f.Close()
+	return ImportMbox(f, me)
+}
+
+// ImportMbox parses an mbox stream, such as a Google Takeout export.
+func ImportMbox(r io.Reader, me []string) ([]Message, error) {
+	var messages []Message
+	var header bytes.Buffer
+	var separatorDate time.Time
+	inMessage, inHeader := false, false
+	// A "From " separator only starts a message at the top of the file or
+	// after a blank line; elsewhere it is part of an unescaped body.
+	afterBlank := true
+	skipped, undated := 0, 0
+
+	flush := func() {
+		if !inMessage {
+			return
+		}
+		if msg, ok := parseArchivedHeader(header.Bytes(), false, me); ok {
+			if msg.Date.IsZero() {
+				msg.Date = separatorDate
+				undated++
+			}
+			messages = append(messages, msg)
+		} else {
+			skipped++
+		}
+		header.Reset()
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			blank := len(bytes.TrimRight(line, "\r\n")) == 0
+			if afterBlank && bytes.HasPrefix(line, []byte("From ")) {
+				flush()
+				inMessage, inHeader = true, true
+				separatorDate = parseSeparatorDate(string(line))
+			} else if inHeader {
+				if blank {
+					inHeader = false
+				}
+				header.Write(line)
+			}
+			afterBlank = blank
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mbox: %v", err)
+		}
+	}
+	flush()
+
+	if skipped > 0 {
+		glog.Warningf("Skipped %d mbox messages with unreadable headers", skipped)
+	}
+	if undated > 0 {
+		glog.Warningf("%d mbox messages had a missing or unparseable Date header; used the mbox separator date instead", undated)
+	}
+	return messages, nil
+}
+
+// parseSeparatorDate returns the date on an mbox "From sender date" line.
+func parseSeparatorDate(line string) time.Time {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return time.Time{}
+	}
+	date, _ := parseEmailDate(strings.Join(fields[2:], " "))
+	return date
+}
+
+// ImportMaildir parses every message in a Maildir directory, including
+// Maildir++ subfolders such as ".Sent".
+func ImportMaildir(root string, me []string) ([]Message, error) {
+	var messages []Message
+	skipped, undated := 0, 0
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == "tmp" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		dir := filepath.Base(filepath.Dir(path))
+		if dir != "cur" && dir != "new" {
+			return nil
+		}
+		folder := filepath.Base(filepath.Dir(filepath.Dir(path)))
+		sent := strings.Contains(strings.ToLower(folder), "sent")
+
+		header, err := readHeader(path)
+		if err != nil {
+			return err
+		}
+		if msg, ok := parseArchivedHeader(header, sent, me); ok {
+			if msg.Date.IsZero() {
+				msg.Date = info.ModTime()
+				undated++
+			}
+			messages = append(messages, msg)
+		} else {
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maildir: %v", err)
+	}
+
+	if skipped > 0 {
+		glog.Warningf("Skipped %d maildir messages with unreadable headers", skipped)
+	}
+	if undated > 0 {
+		glog.Warningf("%d maildir messages had a missing or unparseable Date header; used the file modification time instead", undated)
+	}
+	return messages, nil
+}
+
+// readHeader returns the header block of the message file at path.
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header bytes.Buffer
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		header.Write(line)
+		if len(bytes.TrimRight(line, "\r\n")) == 0 || err != nil {
+			break
+		}
+	}
+	return header.Bytes(), nil
+}
+
+func parseArchivedHeader(raw []byte, sent bool, me []string) (Message, bool) {
+	if !bytes.HasSuffix(raw, []byte("\n\n")) && !bytes.HasSuffix(raw, []byte("\r\n\r\n")) {
+		raw = append(raw, '\n')
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Message{}, false
+	}
+	h := parsed.Header
+
+	msg := Message{
+		From:      extractEmail(h.Get("From")),
+		To:        extractEmails(h.Get("To")),
+		Cc:        extractEmails(h.Get("Cc")),
+		Bcc:       extractEmails(h.Get("Bcc")),
+		MessageID: strings.TrimSpace(h.Get("Message-ID")),
+		Sent:      sent,
+	}
+	if date, err := parseEmailDate(h.Get("Date")); err == nil {
+		msg.Date = date
+	}
+
+	for _, label := range strings.Split(h.Get("X-Gmail-Labels"), ",") {
+		if strings.EqualFold(strings.TrimSpace(label), "Sent") {
+			msg.Sent = true
+		}
+	}
+	for _, address := range me {
+		if strings.EqualFold(msg.From, address) {
+			msg.Sent = true
+		}
+	}
+
+	id := msg.MessageID
+	if id == "" {
+		sum := sha1.Sum([]byte(h.Get("From") + "\n" + h.Get("Date") + "\n" + h.Get("Subject")))
+		id = hex.EncodeToString(sum[:])
+	}
+	msg.ID = "archive:" + id
+	return msg, true
+}
@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportMbox(t *testing.T) {
+	messages, err := ImportMailArchive(filepath.Join("testdata", "takeout.mbox"), nil)
+	if err != nil {
+		t.Fatalf("ImportMailArchive() error: %v", err)
+	}
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(messages), messages)
+	}
+
+	want := Message{
+		ID:        "archive:<me-1@example.com>",
+		From:      "me@example.com",
+		To:        []string{"ada@example.com", "grace@example.com"},
+		Date:      time.Date(2018, 1, 9, 11, 0, 0, 0, time.UTC),
+		Sent:      true,
+		MessageID: "<me-1@example.com>",
+	}
+	got := messages[1]
+	got.Date = got.Date.UTC()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sent message = %+v, want %+v", got, want)
+	}
+
+	if messages[0].Sent || messages[0].From != "ada@example.com" {
+		t.Errorf("received message = %+v, want inbound from ada@example.com", messages[0])
+	}
+	if messages[2].MessageID != "" || messages[2].ID == "archive:" {
+		t.Errorf("message without Message-ID got ID %q", messages[2].ID)
+	}
+	if want := time.Date(2018, 1, 11, 13, 0, 0, 0, time.UTC); !messages[3].Date.Equal(want) {
+		t.Errorf("message with unparseable Date = %v, want separator date %v", messages[3].Date, want)
+	}
+}
+
+func TestImportMaildir(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("cur/1.mail:2,S", "From: ada@example.com\r\nTo: me@example.com\r\nDate: Mon, 08 Jan 2018 10:00:00 +0000\r\nMessage-ID: <a@x>\r\n\r\nHi\r\n")
+	write(".Sent/cur/2.mail:2,S", "From: me@example.com\r\nTo: ada@example.com\r\nDate: Tue, 09 Jan 2018 10:00:00 +0000\r\nMessage-ID: <b@x>\r\n\r\nHi\r\n")
+	write("new/3.mail", "From: work-me@example.com\nTo: grace@example.com\nDate: Wed, 10 Jan 2018 10:00:00 +0000\n\nHi\n")
+	write("tmp/4.mail", "From: ignored@example.com\n\n")
+
+	messages, err := ImportMailArchive(root, []string{"work-me@example.com"})
+	if err != nil {
+		t.Fatalf("ImportMailArchive() error: %v", err)
+	}
+
+	sent := make(map[string]bool)
+	for _, msg := range messages {
+		sent[msg.From] = msg.Sent
+	}
+	want := map[string]bool{
+		"ada@example.com":     false,
+		"me@example.com":      true,
+		"work-me@example.com": true,
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("imported senders = %v, want %v", sent, want)
+	}
+}
+
+func TestInteractionStoreMergesArchive(t *testing.T) {
+	store, err := LoadInteractionStore(filepath.Join(t.TempDir(), "interactions.json"))
+	if err != nil {
+		t.Fatalf("LoadInteractionStore() error: %v", err)
+	}
+
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Put(Message{ID: "gmail-1", From: "ada@example.com", Date: date, MessageID: "<a@x>"})
+	added := store.Import([]Message{
+		{ID: "archive:<a@x>", From: "ada@example.com", Date: date, MessageID: "<a@x>"},
+		{ID: "archive:<b@x>", From: "ada@example.com", Date: date.AddDate(-5, 0, 0), MessageID: "<b@x>"},
+	})
+	if added != 2 {
+		t.Errorf("Import() added %d, want 2", added)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	reloaded, err := LoadInteractionStore(store.path)
+	if err != nil {
+		t.Fatalf("LoadInteractionStore() error: %v", err)
+	}
+	reloaded.Reset()
+	reloaded.Put(Message{ID: "gmail-1", From: "ada@example.com", Date: date, MessageID: "<a@x>"})
+
+	all := reloaded.All()
+	if len(all) != 2 || all[0].ID != "archive:<b@x>" || all[1].ID != "gmail-1" {
+		t.Errorf("All() = %+v, want the old archived message and the synced duplicate once", all)
+	}
+}
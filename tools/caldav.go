@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"socialbot/config"
+	"socialbot/retry"
+
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/golang/glog"
+)
+
+// CalDAVConfig describes how to reach a CalDAV server such as Nextcloud,
+// iCloud or Fastmail.
+type CalDAVConfig struct {
+	URL      string
+	Username string
+	Password string
+
+	// Calendars lists calendar collection paths. If empty, every calendar
+	// in the user's calendar home set is read.
+	Calendars []string
+}
+
+// CalDAVConfigFromEnv reads the CALDAV_* environment variables.
+func CalDAVConfigFromEnv() CalDAVConfig {
+	return CalDAVConfig{
+		URL:       os.Getenv("CALDAV_URL"),
+		Username:  os.Getenv("CALDAV_USERNAME"),
+		Password:  os.Getenv("CALDAV_PASSWORD"),
+		Calendars: config.SplitList(os.Getenv("CALDAV_CALENDARS")),
+	}
+}
+
+// CalDAVTool is a CalendarSource that queries a CalDAV server for events and
+// expands recurring events locally.
+type CalDAVTool struct {
+	cfg    CalDAVConfig
+	client *caldav.Client
+
+	// Me lists my own addresses, used to skip events I declined.
+	Me []string
+}
+
+func NewCalDAVTool(cfg CalDAVConfig) *CalDAVTool {
+	if cfg.URL == "" {
+		glog.Exitf("CALDAV_URL is not set")
+	}
+
+	var httpClient webdav.HTTPClient = statusClient{&http.Client{}}
+	if cfg.Username != "" {
+		httpClient = webdav.HTTPClientWithBasicAuth(httpClient, cfg.Username, cfg.Password)
+	}
+	client, err := caldav.NewClient(httpClient, cfg.URL)
+	if err != nil {
+		glog.Exitf("Unable to create CalDAV client: %v", err)
+	}
+
+	return &CalDAVTool{
+		cfg:    cfg,
+		client: client,
+		Me:     config.SplitList(os.Getenv("MY_EMAILS")),
+	}
+}
+
+func (c *CalDAVTool) GetRecentEvents(ctx context.Context, since time.Time) ([]Event, error) {
+	return c.listEvents(ctx, since, time.Now())
+}
+
+func (c *CalDAVTool) GetUpcomingEvents(ctx context.Context, until time.Time) ([]Event, error) {
+	return c.listEvents(ctx, time.Now(), until)
+}
+
+func (c *CalDAVTool) listEvents(ctx context.Context, from, to time.Time) ([]Event, error) {
+	calendars, err := c.calendars(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &caldav.CalendarQuery{
+		CompRequest: caldav.CalendarCompRequest{
+			Name:     "VCALENDAR",
+			AllProps: true,
+			AllComps: true,
+		},
+		CompFilter: caldav.CompFilter{
+			Name:  "VCALENDAR",
+			Comps: []caldav.CompFilter{{Name: "VEVENT", Start: from.UTC(), End: to.UTC()}},
+		},
+	}
+
+	var result []Event
+	seen := make(map[string]bool)
+	for _, path := range calendars {
+		var objects []caldav.CalendarObject
+		err := retry.Do(ctx, "query calendar "+path, func(ctx context.Context) error {
+			var err error
+			objects, err = c.client.QueryCalendar(ctx, path, query)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query calendar %s: %v", path, err)
+		}
+
+		before := len(result)
+		for _, object := range objects {
+			if object.Data != nil {
+				result = appendICSEvents(result, seen, object.Data, path, from, to, c.Me)
+			}
+		}
+		glog.Infof("Found %d events in calendar %s between %s and %s", len(result)-before, path, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	sortEvents(result)
+	return result, nil
+}
+
+// calendars returns the configured calendar paths, discovering them from the
+// user's calendar home set if none were given.
+func (c *CalDAVTool) calendars(ctx context.Context) ([]string, error) {
+	if len(c.cfg.Calendars) > 0 {
+		return c.cfg.Calendars, nil
+	}
+
+	var principal, homeSet string
+	var calendars []caldav.Calendar
+	err := retry.Do(ctx, "find CalDAV principal", func(ctx context.Context) error {
+		var err error
+		principal, err = c.client.FindCurrentUserPrincipal(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find CalDAV principal: %v", err)
+	}
+	err = retry.Do(ctx, "find calendar home set", func(ctx context.Context) error {
+		var err error
+		homeSet, err = c.client.FindCalendarHomeSet(ctx, principal)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find calendar home set: %v", err)
+	}
+	err = retry.Do(ctx, "list calendars", func(ctx context.Context) error {
+		var err error
+		calendars, err = c.client.FindCalendars(ctx, homeSet)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendars: %v", err)
+	}
+
+	var paths []string
+	for _, cal := range calendars {
+		if supportsEvents(cal) {
+			paths = append(paths, cal.Path)
+		}
+	}
+	glog.V(1).Infof("Discovered CalDAV calendars: %v", paths)
+	return paths, nil
+}
+
+// statusClient reports responses with a transient error status as
+// retry.StatusErrors, which go-webdav would otherwise turn into errors that
+// can't be told apart from permanent ones.
+type statusClient struct {
+	webdav.HTTPClient
+}
+
+func (c statusClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err == nil && retry.TransientStatus(resp.StatusCode) {
+		return nil, retry.CheckResponse(resp)
+	}
+	return resp, err
+}
+
+// supportsEvents reports whether a calendar collection can hold VEVENTs.
+// Servers that don't advertise the supported components are assumed to.
+func supportsEvents(cal caldav.Calendar) bool {
+	if len(cal.SupportedComponentSet) == 0 {
+		return true
+	}
+	for _, comp := range cal.SupportedComponentSet {
+		if comp == "VEVENT" {
+			return true
+		}
+	}
+	return false
+}
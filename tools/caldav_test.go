@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// testCalDAVBackend serves one calendar, /me/calendars/personal/, holding
+// the events of testdata/calendar.ics.
+type testCalDAVBackend struct {
+	objects []caldav.CalendarObject
+}
+
+const testCalendarPath = "/me/calendars/personal/"
+
+func (b *testCalDAVBackend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	return "/me/", nil
+}
+
+func (b *testCalDAVBackend) CalendarHomeSetPath(ctx context.Context) (string, error) {
+	return "/me/calendars/", nil
+}
+
+func (b *testCalDAVBackend) ListCalendars(ctx context.Context) ([]caldav.Calendar, error) {
+	return []caldav.Calendar{{Path: testCalendarPath, Name: "Personal", SupportedComponentSet: []string{"VEVENT"}}}, nil
+}
+
+func (b *testCalDAVBackend) GetCalendar(ctx context.Context, path string) (*caldav.Calendar, error) {
+	return &caldav.Calendar{Path: testCalendarPath, Name: "Personal", SupportedComponentSet: []string{"VEVENT"}}, nil
+}
+
+func (b *testCalDAVBackend) GetCalendarObject(ctx context.Context, path string, req *caldav.CalendarCompRequest) (*caldav.CalendarObject, error) {
+	for _, object := range b.objects {
+		if object.Path == path {
+			return &object, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (b *testCalDAVBackend) ListCalendarObjects(ctx context.Context, path string, req *caldav.CalendarCompRequest) ([]caldav.CalendarObject, error) {
+	return b.objects, nil
+}
+
+func (b *testCalDAVBackend) QueryCalendarObjects(ctx context.Context, query *caldav.CalendarQuery) ([]caldav.CalendarObject, error) {
+	return caldav.Filter(query, b.objects)
+}
+
+func (b *testCalDAVBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *caldav.PutCalendarObjectOptions) (string, error) {
+	return "", http.ErrNotSupported
+}
+
+func (b *testCalDAVBackend) DeleteCalendarObject(ctx context.Context, path string) error {
+	return http.ErrNotSupported
+}
+
+// startCalDAVServer splits testdata/calendar.ics into one calendar object
+// per UID, as a CalDAV server stores them, and serves them over HTTP.
+func startCalDAVServer(t *testing.T) string {
+	t.Helper()
+
+	f, err := os.Open("testdata/calendar.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cal, err := ical.NewDecoder(f).Decode()
+	if err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+
+	backend := &testCalDAVBackend{}
+	byUID := make(map[string]*ical.Calendar)
+	for _, child := range cal.Children {
+		if child.Name != ical.CompEvent {
+			continue
+		}
+		uid, _ := child.Props.Text(ical.PropUID)
+		object, ok := byUID[uid]
+		if !ok {
+			object = ical.NewCalendar()
+			object.Props = cal.Props
+			byUID[uid] = object
+			backend.objects = append(backend.objects, caldav.CalendarObject{
+				Path: testCalendarPath + uid + ".ics",
+				Data: object,
+			})
+		}
+		object.Children = append(object.Children, child)
+	}
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: backend})
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCalDAVToolListEvents(t *testing.T) {
+	want := wantFixtureEvents(t)
+
+	tool := NewCalDAVTool(CalDAVConfig{URL: startCalDAVServer(t)})
+	tool.Me = []string{"me@example.com"}
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	events, err := tool.listEvents(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("listEvents failed: %v", err)
+	}
+	checkEvents(t, events, want)
+	if events[0].Calendar != testCalendarPath {
+		t.Errorf("event calendar = %q, want %q", events[0].Calendar, testCalendarPath)
+	}
+}
@@ -3,9 +3,12 @@ package tools
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"socialbot/auth"
+	"socialbot/config"
+	"socialbot/retry"
 
 	"github.com/golang/glog"
 	"google.golang.org/api/calendar/v3"
@@ -14,19 +17,28 @@ import (
 
 type CalendarTool struct {
 	service *calendar.Service
+
+	// CalendarIDs lists the calendars to read events from.
+	CalendarIDs []string
 }
 
 type Event struct {
 	Title       string
 	StartTime   time.Time
 	EndTime     time.Time
+	AllDay      bool
 	Attendees   []string
 	Description string
+	Calendar    string
 }
 
 func NewCalendarTool() *CalendarTool {
+	return newCalendarTool()
+}
+
+func newCalendarTool(extraScopes ...string) *CalendarTool {
 	ctx := context.Background()
-	client, err := auth.GetClient()
+	client, err := auth.GetClient(extraScopes...)
 	if err != nil {
 		glog.Exitf("Unable to get OAuth client: %v", err)
 	}
@@ -37,43 +49,153 @@ func NewCalendarTool() *CalendarTool {
 	}
 
 	return &CalendarTool{
-		service: srv,
+		service:     srv,
+		CalendarIDs: calendarIDsFromEnv(),
 	}
 }
 
-func (c *CalendarTool) GetRecentEvents(ctx context.Context, since time.Time) ([]Event, error) {
-	events, err := c.service.Events.List("primary").
-		TimeMin(since.Format(time.RFC3339)).
-		TimeMax(time.Now().Format(time.RFC3339)).
-		SingleEvents(true).
-		OrderBy("startTime").
-		Do()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve events: %v", err)
+// calendarIDsFromEnv reads the comma-separated CALENDAR_IDS variable,
+// defaulting to the primary calendar.
+func calendarIDsFromEnv() []string {
+	ids := config.SplitList(os.Getenv("CALENDAR_IDS"))
+	if len(ids) == 0 {
+		return []string{"primary"}
 	}
+	return ids
+}
 
-	glog.Infof("Found %d calendar events since %s", len(events.Items), since.Format("2006-01-02"))
+func (c *CalendarTool) GetRecentEvents(ctx context.Context, since time.Time) ([]Event, error) {
+	return c.listEvents(ctx, since, time.Now())
+}
 
+func (c *CalendarTool) GetUpcomingEvents(ctx context.Context, until time.Time) ([]Event, error) {
+	return c.listEvents(ctx, time.Now(), until)
+}
+
+// listEvents returns the events between from and to across every configured
+// calendar, sorted by start time. Cancelled events, events I declined and
+// duplicates of an event shared between calendars are dropped.
+func (c *CalendarTool) listEvents(ctx context.Context, from, to time.Time) ([]Event, error) {
 	var result []Event
-	for _, item := range events.Items {
-		startTime, _ := time.Parse(time.RFC3339, item.Start.DateTime)
-		endTime, _ := time.Parse(time.RFC3339, item.End.DateTime)
-
-		attendees := make([]string, 0, len(item.Attendees))
-		for _, attendee := range item.Attendees {
-			attendees = append(attendees, attendee.Email)
-			glog.V(2).Infof("Event '%s' includes attendee: %s", item.Summary, attendee.Email)
+	seen := make(map[string]bool)
+
+	for _, calendarID := range c.CalendarIDs {
+		items, err := c.listCalendar(ctx, calendarID, from, to)
+		if err != nil {
+			return nil, err
 		}
+		glog.Infof("Found %d events in calendar %s between %s and %s", len(items), calendarID, from.Format("2006-01-02"), to.Format("2006-01-02"))
 
-		result = append(result, Event{
-			Title:       item.Summary,
-			StartTime:   startTime,
-			EndTime:     endTime,
-			Attendees:   attendees,
-			Description: item.Description,
-		})
+		for _, item := range items {
+			if item.Status == "cancelled" {
+				glog.V(2).Infof("Skipping cancelled event '%s'", item.Summary)
+				continue
+			}
+			if declined(item) {
+				glog.V(2).Infof("Skipping declined event '%s'", item.Summary)
+				continue
+			}
+
+			event, err := convertEvent(calendarID, item)
+			if err != nil {
+				glog.Warningf("Skipping event '%s': %v", item.Summary, err)
+				continue
+			}
+
+			key := item.ICalUID + "/" + event.StartTime.String()
+			if item.ICalUID != "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, event)
+		}
 	}
 
+	sortEvents(result)
+
 	glog.Infof("Processed %d calendar events with attendees", len(result))
 	return result, nil
 }
+
+// listCalendar returns every event instance in one calendar, following
+// NextPageToken until the listing is exhausted.
+func (c *CalendarTool) listCalendar(ctx context.Context, calendarID string, from, to time.Time) ([]*calendar.Event, error) {
+	var items []*calendar.Event
+	pageToken := ""
+	for {
+		call := c.service.Events.List(calendarID).
+			TimeMin(from.Format(time.RFC3339)).
+			TimeMax(to.Format(time.RFC3339)).
+			SingleEvents(true).
+			OrderBy("startTime")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var page *calendar.Events
+		err := retry.Do(ctx, "list events", func(ctx context.Context) error {
+			var err error
+			page, err = call.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve events from %s: %v", calendarID, err)
+		}
+
+		items = append(items, page.Items...)
+		if page.NextPageToken == "" {
+			return items, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// declined reports whether I declined the event.
+func declined(item *calendar.Event) bool {
+	for _, attendee := range item.Attendees {
+		if attendee.Self && attendee.ResponseStatus == "declined" {
+			return true
+		}
+	}
+	return false
+}
+
+func convertEvent(calendarID string, item *calendar.Event) (Event, error) {
+	event := Event{
+		Title:       item.Summary,
+		Description: item.Description,
+		Calendar:    calendarID,
+	}
+
+	var err error
+	if event.StartTime, event.AllDay, err = parseEventTime(item.Start); err != nil {
+		return event, fmt.Errorf("invalid start: %v", err)
+	}
+	if event.EndTime, _, err = parseEventTime(item.End); err != nil {
+		return event, fmt.Errorf("invalid end: %v", err)
+	}
+
+	event.Attendees = make([]string, 0, len(item.Attendees))
+	for _, attendee := range item.Attendees {
+		event.Attendees = append(event.Attendees, attendee.Email)
+		glog.V(2).Infof("Event '%s' includes attendee: %s", item.Summary, attendee.Email)
+	}
+	return event, nil
+}
+
+// parseEventTime handles both timed events and all-day events, which only
+// carry a date. All-day dates are interpreted in the local time zone.
+func parseEventTime(t *calendar.EventDateTime) (time.Time, bool, error) {
+	if t == nil {
+		return time.Time{}, false, fmt.Errorf("missing time")
+	}
+	if t.DateTime != "" {
+		parsed, err := time.Parse(time.RFC3339, t.DateTime)
+		return parsed, false, err
+	}
+	if t.Date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", t.Date, time.Local)
+		return parsed, true, err
+	}
+	return time.Time{}, false, fmt.Errorf("event has neither dateTime nor date")
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+func TestCalendarToolListEvents(t *testing.T) {
+	// Each calendar's events, split into pages.
+	pages := map[string][]*calendar.Events{
+		"primary": {
+			{
+				Items: []*calendar.Event{
+					{Summary: "Lunch with Ada", ICalUID: "lunch", Status: "confirmed",
+						Start:     &calendar.EventDateTime{DateTime: "2024-03-05T12:00:00Z"},
+						End:       &calendar.EventDateTime{DateTime: "2024-03-05T13:00:00Z"},
+						Attendees: []*calendar.EventAttendee{{Email: "me@example.com", Self: true}, {Email: "ada@example.com"}}},
+					{Summary: "Team offsite", Status: "confirmed",
+						Start: &calendar.EventDateTime{Date: "2024-03-07"},
+						End:   &calendar.EventDateTime{Date: "2024-03-08"}},
+				},
+				NextPageToken: "page2",
+			},
+			{
+				Items: []*calendar.Event{
+					{Summary: "Declined sync", Status: "confirmed",
+						Start:     &calendar.EventDateTime{DateTime: "2024-03-06T09:00:00Z"},
+						End:       &calendar.EventDateTime{DateTime: "2024-03-06T10:00:00Z"},
+						Attendees: []*calendar.EventAttendee{{Email: "me@example.com", Self: true, ResponseStatus: "declined"}}},
+					{Summary: "Cancelled dinner", Status: "cancelled",
+						Start: &calendar.EventDateTime{DateTime: "2024-03-08T19:00:00Z"},
+						End:   &calendar.EventDateTime{DateTime: "2024-03-08T21:00:00Z"}},
+					{Summary: "Grace 1:1", Status: "confirmed",
+						Start:     &calendar.EventDateTime{DateTime: "2024-03-04T10:00:00-05:00"},
+						End:       &calendar.EventDateTime{DateTime: "2024-03-04T10:30:00-05:00"},
+						Attendees: []*calendar.EventAttendee{{Email: "grace@example.com"}}},
+				},
+			},
+		},
+		"work": {
+			{
+				Items: []*calendar.Event{
+					// The same lunch, shared with the work calendar.
+					{Summary: "Lunch with Ada", ICalUID: "lunch", Status: "confirmed",
+						Start: &calendar.EventDateTime{DateTime: "2024-03-05T12:00:00Z"},
+						End:   &calendar.EventDateTime{DateTime: "2024-03-05T13:00:00Z"}},
+					{Summary: "Planning", Status: "confirmed",
+						Start: &calendar.EventDateTime{DateTime: "2024-03-06T08:00:00Z"},
+						End:   &calendar.EventDateTime{DateTime: "2024-03-06T09:00:00Z"}},
+				},
+			},
+		},
+	}
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var calendarID string
+		switch r.URL.Path {
+		case "/calendars/primary/events":
+			calendarID = "primary"
+		case "/calendars/work/events":
+			calendarID = "work"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("singleEvents") != "true" || query.Get("timeMin") == "" || query.Get("timeMax") == "" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		page := 0
+		if query.Get("pageToken") == "page2" {
+			page = 1
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pages[calendarID][page])
+	}))
+	defer srv.Close()
+
+	service, err := calendar.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("failed to create Calendar service: %v", err)
+	}
+	tool := &CalendarTool{service: service, CalendarIDs: []string{"primary", "work"}}
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	events, err := tool.listEvents(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("listEvents failed: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("made %d requests, want two pages of primary and one of work", requests)
+	}
+
+	checkEvents(t, events, []eventSummary{
+		{"Grace 1:1", time.Date(2024, 3, 4, 15, 0, 0, 0, time.UTC)},
+		{"Lunch with Ada", time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)},
+		{"Planning", time.Date(2024, 3, 6, 8, 0, 0, 0, time.UTC)},
+		{"Team offsite", time.Date(2024, 3, 7, 0, 0, 0, 0, time.Local)},
+	})
+
+	lunch := events[1]
+	if lunch.Calendar != "primary" || len(lunch.Attendees) != 2 || lunch.Attendees[1] != "ada@example.com" {
+		t.Errorf("lunch = %+v, want the primary calendar's copy with both attendees", lunch)
+	}
+	if events[2].Calendar != "work" {
+		t.Errorf("planning came from calendar %q, want work", events[2].Calendar)
+	}
+	offsite := events[3]
+	if !offsite.AllDay || offsite.StartTime.Location() != time.Local || !offsite.EndTime.Equal(time.Date(2024, 3, 8, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("offsite = %+v, want an all-day event in the local time zone", offsite)
+	}
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// dateComment matches RFC 5322 comments such as "(UTC)" or "(PST)".
+	dateComment = regexp.MustCompile(`\([^()]*\)`)
+
+	// obsoleteZones maps the zone names allowed by RFC 822 to their offsets.
+	// time.Parse would otherwise treat unknown abbreviations as UTC.
+	obsoleteZones = map[string]string{
+		"UT":  "+0000",
+		"UTC": "+0000",
+		"GMT": "+0000",
+		"Z":   "+0000",
+		"EST": "-0500",
+		"EDT": "-0400",
+		"CST": "-0600",
+		"CDT": "-0500",
+		"MST": "-0700",
+		"MDT": "-0600",
+		"PST": "-0800",
+		"PDT": "-0700",
+	}
+
+	// dateLayouts are tried in order once the date has been normalized.
+	dateLayouts = []string{
+		"2 Jan 2006 15:04:05 -0700",
+		"2 Jan 2006 15:04 -0700",
+		"2 Jan 06 15:04:05 -0700",
+		"2 Jan 06 15:04 -0700",
+		"2 Jan 2006 15:04:05",
+		"2 Jan 2006 15:04",
+		"Jan 2 2006 15:04:05 -0700",
+		"Jan 2 15:04:05 2006 -0700",
+		"Jan 2 15:04:05 2006",
+		"Jan 2 15:04:05 -0700 2006",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04:05-0700",
+	}
+)
+
+// parseEmailDate parses a Date header, tolerating the variants seen in real
+// mail: comments like "(UTC)", missing day names or seconds, single-digit
+// days, two-digit years, obsolete zone names and extra whitespace.
+func parseEmailDate(date string) (time.Time, error) {
+	normalized := normalizeEmailDate(date)
+	if normalized == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+	if t, err := mail.ParseDate(normalized); err == nil {
+		return t, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unparseable date %q", date)
+}
+
+// normalizeEmailDate strips comments and day names, collapses whitespace and
+// replaces obsolete or military zone names with numeric offsets.
+func normalizeEmailDate(date string) string {
+	date = dateComment.ReplaceAllString(date, " ")
+	fields := strings.Fields(strings.ReplaceAll(date, ",", " "))
+
+	// Drop a leading day name such as "Mon" or "Monday".
+	if len(fields) > 0 && isDayName(fields[0]) {
+		fields = fields[1:]
+	}
+
+	for i, field := range fields {
+		upper := strings.ToUpper(field)
+		if offset, ok := obsoleteZones[upper]; ok {
+			fields[i] = offset
+		} else if len(upper) == 1 && upper[0] >= 'A' && upper[0] <= 'Z' && upper != "J" {
+			// RFC 5322 says military zones carry no information.
+			fields[i] = "-0000"
+		} else if strings.HasPrefix(upper, "GMT") || strings.HasPrefix(upper, "UTC") {
+			// "GMT+0100" and similar.
+			if rest := field[3:]; len(rest) == 5 && (rest[0] == '+' || rest[0] == '-') {
+				fields[i] = rest
+			}
+		}
+	}
+
+	// "-0700 -0700" can appear after a zone name has been replaced.
+	if n := len(fields); n >= 2 && fields[n-1] == fields[n-2] && isOffset(fields[n-1]) {
+		fields = fields[:n-1]
+	}
+	return strings.Join(fields, " ")
+}
+
+func isDayName(s string) bool {
+	s = strings.ToLower(strings.TrimSuffix(s, "."))
+	for _, day := range []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"} {
+		if strings.HasPrefix(s, day) && !strings.ContainsAny(s, "0123456789") {
+			return true
+		}
+	}
+	return false
+}
+
+func isOffset(s string) bool {
+	return len(s) == 5 && (s[0] == '+' || s[0] == '-')
+}
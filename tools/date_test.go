@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEmailDate(t *testing.T) {
+	want := time.Date(2024, 3, 5, 14, 7, 9, 0, time.FixedZone("", -8*60*60))
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"Tue, 05 Mar 2024 14:07:09 -0800", want},
+		{"Tue, 5 Mar 2024 14:07:09 -0800", want},
+		{"5 Mar 2024 14:07:09 -0800", want},
+		{"Tue, 05 Mar 2024 14:07:09 -0800 (PST)", want},
+		{"Tue, 05 Mar 2024 22:07:09 +0000 (UTC)", want},
+		{"Tue,  5 Mar 2024 14:07:09   -0800", want},
+		{"Tue, 05 Mar 2024 14:07:09 PST", want},
+		{"Tue, 05 Mar 2024 22:07:09 GMT", want},
+		{"Tue, 05 Mar 2024 22:07:09 UT", want},
+		{"Tuesday, 05 Mar 2024 14:07:09 -0800", want},
+		{"Tue, 05 Mar 24 14:07:09 -0800", want},
+		{"Tue, 05 Mar 2024 14:07 -0800", want.Add(-9 * time.Second)},
+		{"Tue, 05 Mar 2024 22:07:09 GMT+0000", want},
+		{"Tue Mar  5 14:07:09 2024 -0800", want},
+		{"2024-03-05T14:07:09-08:00", want},
+		{"Tue, 05 Mar 2024 22:07:09 Z", want},
+	}
+
+	for _, tt := range tests {
+		got, err := parseEmailDate(tt.in)
+		if err != nil {
+			t.Errorf("parseEmailDate(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseEmailDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "yesterday", "(no date)"} {
+		if got, err := parseEmailDate(bad); err == nil {
+			t.Errorf("parseEmailDate(%q) = %v, want error", bad, got)
+		}
+	}
+}
@@ -1,44 +1,172 @@
 package tools
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/mail"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"socialbot/auth"
 	"socialbot/config"
+	"socialbot/retry"
 
 	"github.com/golang/glog"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
+const (
+	listPageSize     = 500
+	fetchWorkers     = 10
+	progressInterval = 50
+)
+
+// interactionHeaders are the only headers requested when fetching messages.
+var interactionHeaders = []string{"From", "To", "Cc", "Bcc", "Date", "Message-ID"}
+
 type EmailTool struct {
-	service *gmail.Service
+	service    *gmail.Service
+	identities *config.Identities
+
+	// Progress, if set, receives a running count of fetched messages.
+	Progress io.Writer
+
+	// Store, if set, caches interactions locally. It is synced once per
+	// EmailTool and then queried instead of searching Gmail.
+	Store *InteractionStore
+	// SyncHorizon bounds how far back a full sync of the Store reaches.
+	SyncHorizon time.Duration
+
+	synced bool
 }
 
 type EmailInteraction struct {
-	Participant string
-	Name        string
-	Priority    int
-	LastContact time.Time
-	Count       int
+	Participant   string
+	Name          string
+	Priority      int
+	LastContact   time.Time
+	Count         int
+	SentCount     int
+	ReceivedCount int
+	LastSent      time.Time
+	LastReceived  time.Time
+
+	// Meetings are calendar events the contact attended, counted separately
+	// from email. MeetingWeight discounts large meetings; see MeetingWeight.
+	MeetingCount  int
+	OneOnOneCount int
+	MeetingWeight float64
+	LastMet       time.Time
+}
+
+// AwaitingReply reports whether the contact wrote to me more recently than I
+// wrote to them.
+func (i EmailInteraction) AwaitingReply() bool {
+	return !i.LastReceived.IsZero() && i.LastReceived.After(i.LastSent)
+}
+
+// Message holds the headers of a single email needed to track interactions.
+// Sent is true for messages in the SENT label, i.e. written by me. Draft,
+// Spam and Trash mark messages in the matching labels, which were never
+// exchanged with anyone and so are not interactions.
+type Message struct {
+	ID    string    `json:"id"`
+	From  string    `json:"from,omitempty"`
+	To    []string  `json:"to,omitempty"`
+	Cc    []string  `json:"cc,omitempty"`
+	Bcc   []string  `json:"bcc,omitempty"`
+	Date  time.Time `json:"date"`
+	Sent  bool      `json:"sent,omitempty"`
+	Draft bool      `json:"draft,omitempty"`
+	Spam  bool      `json:"spam,omitempty"`
+	Trash bool      `json:"trash,omitempty"`
+
+	// MessageID is the RFC 5322 Message-ID, used to avoid counting the same
+	// message twice when it is both synced and imported from an archive.
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// Exchanged reports whether the message counts as an interaction: it is not
+// an unsent draft, spam or in the trash.
+func (m Message) Exchanged() bool {
+	return !m.Draft && !m.Spam && !m.Trash
+}
+
+// Participants returns the other people involved in the message: the
+// recipients of mail I sent, or the sender of mail I received.
+func (m Message) Participants() []string {
+	if !m.Sent {
+		if m.From == "" {
+			return nil
+		}
+		return []string{m.From}
+	}
+
+	var participants []string
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		participants = append(participants, list...)
+	}
+	return participants
 }
 
 type DraftEmail struct {
 	Subject string
 	Body    string
+	From    string
 	To      string
+	Cc      []string
+	Bcc     []string
+
+	Attachments []Attachment
+
+	// ThreadID, InReplyTo and References are set when the draft replies to
+	// an existing conversation.
+	ThreadID   string
+	InReplyTo  string
+	References string
+}
+
+// Thread identifies the most recent message in a conversation so a draft can
+// be saved as a reply to it.
+type Thread struct {
+	ID         string
+	Subject    string
+	MessageID  string
+	References string
+	Date       time.Time
+}
+
+// ReplyTo marks the draft as a reply to the latest message in thread.
+func (d *DraftEmail) ReplyTo(thread Thread) {
+	d.ThreadID = thread.ID
+	d.Subject = ReplySubject(thread.Subject)
+	d.InReplyTo = thread.MessageID
+	d.References = strings.TrimSpace(thread.References + " " + thread.MessageID)
+}
+
+// ReplySubject prefixes subject with "Re: " unless it is already a reply.
+func ReplySubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if len(subject) >= 3 && strings.EqualFold(subject[:3], "re:") {
+		return subject
+	}
+	return "Re: " + subject
 }
 
-func NewEmailTool() *EmailTool {
+// NewEmailTool connects to Gmail, matching addresses to contacts through
+// identities.
+func NewEmailTool(identities *config.Identities) *EmailTool {
 	ctx := context.Background()
 	client, err := auth.GetClient()
 	if err != nil {
@@ -51,7 +179,10 @@ func NewEmailTool() *EmailTool {
 	}
 
 	return &EmailTool{
-		service: srv,
+		service:     srv,
+		identities:  identities,
+		Progress:    os.Stderr,
+		SyncHorizon: 5 * 365 * 24 * time.Hour,
 	}
 }
 
@@ -102,99 +233,337 @@ func saveToken(path string, token *oauth2.Token) {
 	json.NewEncoder(f).Encode(token)
 }
 
-func (e *EmailTool) filterAndEnrichInteractions(interactions []EmailInteraction) []EmailInteraction {
-	importantContacts := config.GetImportantContacts()
-	contactMap := make(map[string]config.Contact)
-	for _, contact := range importantContacts {
-		contactMap[contact.Email] = contact
+// SummarizeInteractions aggregates messages into one interaction per
+// important contact, resolving every participant address through identities
+// so aliases and differently formatted addresses count as the same person.
+func SummarizeInteractions(messages []Message, identities *config.Identities) []EmailInteraction {
+	interactions := make(map[string]*EmailInteraction)
+	others := make(map[string]bool)
+
+	for _, msg := range messages {
+		if !msg.Exchanged() {
+			glog.V(2).Infof("Skipping message %s: draft, spam or trash", msg.ID)
+			continue
+		}
+		participants := msg.Participants()
+		if len(participants) == 0 {
+			glog.V(2).Infof("Skipping message %s: no participants", msg.ID)
+			continue
+		}
+
+		seen := make(map[string]bool)
+		for _, participant := range participants {
+			if participant == "" {
+				continue
+			}
+			contact := identities.Resolve(participant)
+			if contact == nil {
+				others[identities.Normalize(participant)] = true
+				continue
+			}
+			if seen[contact.Email] {
+				continue
+			}
+			seen[contact.Email] = true
+
+			interaction, exists := interactions[contact.Email]
+			if !exists {
+				interaction = &EmailInteraction{
+					Participant: contact.Email,
+					Name:        contact.Name,
+					Priority:    contact.Priority,
+				}
+				interactions[contact.Email] = interaction
+			}
+
+			interaction.Count++
+			if msg.Date.After(interaction.LastContact) {
+				interaction.LastContact = msg.Date
+			}
+			if msg.Sent {
+				interaction.SentCount++
+				if msg.Date.After(interaction.LastSent) {
+					interaction.LastSent = msg.Date
+				}
+			} else {
+				interaction.ReceivedCount++
+				if msg.Date.After(interaction.LastReceived) {
+					interaction.LastReceived = msg.Date
+				}
+			}
+		}
 	}
 
-	var filtered []EmailInteraction
+	result := make([]EmailInteraction, 0, len(interactions))
 	for _, interaction := range interactions {
-		if contact, ok := contactMap[interaction.Participant]; ok {
-			interaction.Name = contact.Name
-			interaction.Priority = contact.Priority
-			filtered = append(filtered, interaction)
-		}
+		result = append(result, *interaction)
 	}
-	return filtered
+	sortInteractions(result)
+
+	glog.Infof("Found %d total participants, filtered to %d important contacts", len(result)+len(others), len(result))
+	return result
 }
 
-func (e *EmailTool) GetInteractionsByParticipant(ctx context.Context, participant string) ([]EmailInteraction, error) {
-	query := fmt.Sprintf("(from:%s OR to:%s)", participant, participant)
-	return e.GetRecentInteractions(ctx, time.Now().AddDate(0, 0, -30), query)
+// participantQuery builds a Gmail search matching mail to or from any of
+// the given addresses.
+func participantQuery(addresses []string) string {
+	terms := make([]string, 0, 2*len(addresses))
+	for _, address := range addresses {
+		terms = append(terms, "from:"+address, "to:"+address)
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+func (e *EmailTool) GetInteractionsByParticipant(ctx context.Context, participant string, since time.Time) ([]EmailInteraction, error) {
+	if e.Store != nil {
+		return e.storedInteractions(ctx, since, participant)
+	}
+
+	query := participantQuery(e.identities.AddressesFor(participant))
+	return e.GetRecentInteractions(ctx, since, query)
 }
 
 func (e *EmailTool) GetRecentInteractions(ctx context.Context, since time.Time, query string) ([]EmailInteraction, error) {
+	if e.Store != nil && query == "" {
+		return e.storedInteractions(ctx, since, "")
+	}
+
 	// Format the date as YYYY/MM/DD for Gmail's query syntax
 	query += fmt.Sprintf(" after:%s", since.Format("2006/01/02"))
 	glog.Infof("Querying emails with: %s", query)
 
-	messages, err := e.service.Users.Messages.
-		List("me").
-		Q(query).
-		MaxResults(500). // Add reasonable limit
-		Do()
+	ids, err := e.listMessageIDs(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list messages: %v", err)
+		return nil, err
 	}
 
-	glog.Infof("Found %d total messages", len(messages.Messages))
+	glog.Infof("Found %d total messages", len(ids))
 
-	interactions := make(map[string]*EmailInteraction)
+	headers, err := e.fetchMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeInteractions(headers, e.identities), nil
+}
+
+// storedInteractions syncs the local store if needed and summarizes the
+// stored messages involving participant since the given time.
+func (e *EmailTool) storedInteractions(ctx context.Context, since time.Time, participant string) ([]EmailInteraction, error) {
+	if !e.synced {
+		if err := e.Sync(ctx, e.Store); err != nil {
+			return nil, fmt.Errorf("failed to sync mail: %v", err)
+		}
+		e.synced = true
+	}
+
+	messages := FilterMessages(e.Store.All(), since, participant, e.identities)
+	glog.Infof("Found %d stored messages since %s", len(messages), since.Format("2006-01-02"))
+	return SummarizeInteractions(messages, e.identities), nil
+}
 
-	for _, msg := range messages.Messages {
-		message, err := e.service.Users.Messages.Get("me", msg.Id).Do()
+// listMessageIDs returns the IDs of every message matching query, following
+// NextPageToken until the listing is exhausted.
+func (e *EmailTool) listMessageIDs(ctx context.Context, query string) ([]string, error) {
+	var ids []string
+	pageToken := ""
+	for {
+		call := e.service.Users.Messages.
+			List("me").
+			Q(query).
+			MaxResults(listPageSize)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var page *gmail.ListMessagesResponse
+		err := retry.Do(ctx, "list messages", func(ctx context.Context) error {
+			var err error
+			page, err = call.Context(ctx).Do()
+			return err
+		})
 		if err != nil {
-			glog.V(2).Infof("Error getting message %s: %v", msg.Id, err)
-			continue
+			return nil, fmt.Errorf("failed to list messages: %v", err)
 		}
 
-		var from string
-		var date time.Time
+		for _, msg := range page.Messages {
+			ids = append(ids, msg.Id)
+		}
+		glog.V(1).Infof("Listed %d messages so far", len(ids))
 
-		for _, header := range message.Payload.Headers {
-			switch header.Name {
-			case "From":
-				from = extractEmail(header.Value)
-				glog.V(2).Infof("Found email from: %s (raw: %s)", from, header.Value)
-			case "Date":
-				date, _ = parseEmailDate(header.Value)
+		if page.NextPageToken == "" {
+			return ids, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// fetchMessages retrieves the interaction headers for each message ID using
+// a bounded pool of workers. Messages deleted since they were listed are
+// skipped. If any other message cannot be fetched, or ctx is done before
+// every message has been, it returns an error with the messages it did get.
+func (e *EmailTool) fetchMessages(ctx context.Context, ids []string) ([]Message, error) {
+	results := make([]*Message, len(ids))
+	errs := make([]error, len(ids))
+	jobs := make(chan int)
+	var done, undated int64
+
+	var wg sync.WaitGroup
+	for w := 0; w < fetchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				msg, internalDate, err := e.fetchMessage(ctx, ids[i])
+				switch {
+				case isNotFound(err):
+					glog.V(2).Infof("Message %s no longer exists", ids[i])
+				case err != nil:
+					glog.V(2).Infof("Error getting message %s: %v", ids[i], err)
+					errs[i] = err
+				default:
+					results[i] = msg
+				}
+				if internalDate {
+					atomic.AddInt64(&undated, 1)
+				}
+				e.reportProgress(int(atomic.AddInt64(&done, 1)), len(ids))
 			}
+		}()
+	}
+
+dispatch:
+	for i := range ids {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
 		}
+	}
+	close(jobs)
+	wg.Wait()
 
-		if from == "" {
-			glog.V(2).Infof("Skipping message %s: no From header", msg.Id)
-			continue
+	if undated > 0 {
+		glog.Warningf("%d of %d messages had a missing or unparseable Date header; used Gmail's internal date instead", undated, len(ids))
+	}
+
+	headers := make([]Message, 0, len(ids))
+	for _, msg := range results {
+		if msg != nil {
+			headers = append(headers, *msg)
 		}
+	}
 
-		if interaction, exists := interactions[from]; exists {
-			interaction.Count++
-			if date.After(interaction.LastContact) {
-				interaction.LastContact = date
-			}
-		} else {
-			interactions[from] = &EmailInteraction{
-				Participant: from,
-				LastContact: date,
-				Count:       1,
+	if err := ctx.Err(); err != nil {
+		return headers, err
+	}
+	failed := 0
+	var firstErr error
+	for _, err := range errs {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
 			}
+			failed++
 		}
 	}
+	if failed > 0 {
+		return headers, fmt.Errorf("failed to fetch %d of %d messages: %v", failed, len(ids), firstErr)
+	}
+	return headers, nil
+}
 
-	result := make([]EmailInteraction, 0, len(interactions))
-	for _, interaction := range interactions {
-		result = append(result, *interaction)
+// isNotFound reports whether err is Gmail saying the requested resource does
+// not exist.
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// fetchMessage retrieves only the headers needed to track an interaction.
+// It reports whether the Date header was unusable and Gmail's internal date
+// was used in its place.
+func (e *EmailTool) fetchMessage(ctx context.Context, id string) (*Message, bool, error) {
+	var message *gmail.Message
+	err := retry.Do(ctx, "get message "+id, func(ctx context.Context) error {
+		var err error
+		message, err = e.service.Users.Messages.
+			Get("me", id).
+			Format("metadata").
+			MetadataHeaders(interactionHeaders...).
+			Context(ctx).
+			Do()
+		return err
+	})
+	if err != nil {
+		return nil, false, err
 	}
 
-	filtered := e.filterAndEnrichInteractions(result)
-	glog.Infof("Found %d total interactions, filtered to %d important contacts", len(result), len(filtered))
+	header := Message{ID: id}
+	for _, label := range message.LabelIds {
+		switch label {
+		case "SENT":
+			header.Sent = true
+		case "DRAFT":
+			header.Draft = true
+		case "SPAM":
+			header.Spam = true
+		case "TRASH":
+			header.Trash = true
+		}
+	}
 
-	return filtered, nil
+	var headers []*gmail.MessagePartHeader
+	if message.Payload != nil {
+		headers = message.Payload.Headers
+	}
+	for _, h := range headers {
+		switch h.Name {
+		case "From":
+			header.From = extractEmail(h.Value)
+			glog.V(2).Infof("Found email from: %s (raw: %s)", header.From, h.Value)
+		case "To":
+			header.To = extractEmails(h.Value)
+		case "Cc":
+			header.Cc = extractEmails(h.Value)
+		case "Bcc":
+			header.Bcc = extractEmails(h.Value)
+		case "Date":
+			date, err := parseEmailDate(h.Value)
+			if err != nil {
+				glog.V(2).Infof("Message %s: %v", id, err)
+			}
+			header.Date = date
+		case "Message-ID", "Message-Id":
+			header.MessageID = strings.TrimSpace(h.Value)
+		}
+	}
+
+	if header.Date.IsZero() {
+		header.Date = time.UnixMilli(message.InternalDate)
+		return &header, true, nil
+	}
+	return &header, false, nil
+}
+
+func (e *EmailTool) reportProgress(done, total int) {
+	if done%progressInterval != 0 && done != total {
+		return
+	}
+	glog.V(1).Infof("Fetched %d/%d messages", done, total)
+	if e.Progress != nil {
+		fmt.Fprintf(e.Progress, "\rFetching messages: %d/%d", done, total)
+		if done == total {
+			fmt.Fprintln(e.Progress)
+		}
+	}
 }
 
 func extractEmail(from string) string {
-	// Handle different email formats
+	if address, err := mail.ParseAddress(from); err == nil {
+		return address.Address
+	}
+
+	// Fall back to handling malformed headers by hand
 	// Format 1: "Name <email@domain.com>"
 	if start := strings.Index(from, "<"); start >= 0 {
 		if end := strings.Index(from[start:], ">"); end >= 0 {
@@ -211,32 +580,105 @@ func extractEmail(from string) string {
 	return strings.TrimSpace(from)
 }
 
-func parseEmailDate(date string) (time.Time, error) {
-	return time.Parse(time.RFC1123Z, date)
+// extractEmails returns the bare addresses in a To/Cc/Bcc header value.
+func extractEmails(list string) []string {
+	var emails []string
+	if addresses, err := mail.ParseAddressList(list); err == nil {
+		for _, address := range addresses {
+			emails = append(emails, address.Address)
+		}
+		return emails
+	}
+
+	for _, part := range strings.Split(list, ",") {
+		if email := extractEmail(part); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
 }
 
-func (e *EmailTool) SaveDraft(ctx context.Context, draft DraftEmail) error {
-	var message bytes.Buffer
+// GetLatestThread returns the conversation containing the most recent message
+// to or from participant, or nil if there is none. Unsent drafts, spam and
+// trash are left out so a reply never refers to a message that wasn't sent.
+func (e *EmailTool) GetLatestThread(ctx context.Context, participant string) (*Thread, error) {
+	query := participantQuery(e.identities.AddressesFor(participant)) + " -in:drafts -in:spam -in:trash"
+
+	var list *gmail.ListMessagesResponse
+	err := retry.Do(ctx, "list messages", func(ctx context.Context) error {
+		var err error
+		list, err = e.service.Users.Messages.List("me").Q(query).MaxResults(1).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %v", err)
+	}
+	if len(list.Messages) == 0 {
+		return nil, nil
+	}
+
+	var message *gmail.Message
+	err = retry.Do(ctx, "get message", func(ctx context.Context) error {
+		var err error
+		message, err = e.service.Users.Messages.
+			Get("me", list.Messages[0].Id).
+			Format("metadata").
+			MetadataHeaders("Subject", "Message-ID", "References", "Date").
+			Context(ctx).
+			Do()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %v", err)
+	}
+
+	thread := &Thread{ID: message.ThreadId}
+	if message.Payload != nil {
+		for _, h := range message.Payload.Headers {
+			switch strings.ToLower(h.Name) {
+			case "subject":
+				thread.Subject = h.Value
+			case "message-id":
+				thread.MessageID = h.Value
+			case "references":
+				thread.References = h.Value
+			case "date":
+				thread.Date, _ = parseEmailDate(h.Value)
+			}
+		}
+	}
+	if thread.Date.IsZero() {
+		thread.Date = time.UnixMilli(message.InternalDate)
+	}
+	return thread, nil
+}
 
-	// Format email according to RFC 822
-	fmt.Fprintf(&message, "From: me\n")
-	fmt.Fprintf(&message, "To: %s\n", draft.To)
-	fmt.Fprintf(&message, "Subject: %s\n", draft.Subject)
-	fmt.Fprintf(&message, "Content-Type: text/plain; charset=UTF-8\n")
-	fmt.Fprintf(&message, "\n%s", draft.Body)
+func (e *EmailTool) SaveDraft(ctx context.Context, draft DraftEmail) error {
+	message, err := BuildMessage(draft, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to build message: %v", err)
+	}
 
 	// Create the draft
 	gmailDraft := &gmail.Draft{
 		Message: &gmail.Message{
-			Raw: base64.URLEncoding.EncodeToString(message.Bytes()),
+			Raw:      base64.URLEncoding.EncodeToString(message),
+			ThreadId: draft.ThreadID,
 		},
 	}
 
-	_, err := e.service.Users.Drafts.Create("me", gmailDraft).Do()
+	err = retry.DoWrite(ctx, "create draft", func(ctx context.Context) error {
+		_, err := e.service.Users.Drafts.Create("me", gmailDraft).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create draft: %v", err)
 	}
 
+	if draft.ThreadID != "" {
+		glog.Infof("Draft saved for %s in thread %s", draft.To, draft.ThreadID)
+		return nil
+	}
 	glog.Infof("Draft saved for %s", draft.To)
 	return nil
 }
@@ -0,0 +1,288 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"socialbot/config"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+// fakeGmail serves the parts of the Gmail API that EmailTool uses from
+// in-memory messages.
+type fakeGmail struct {
+	mu sync.Mutex
+
+	messages  map[string]*gmail.Message
+	pageSize  int
+	historyID uint64
+	history   []*gmail.History
+
+	// expired makes history requests fail as if the start ID were too old.
+	expired bool
+	// failing lists message IDs that can't be fetched.
+	failing map[string]bool
+	// onGet, if set, is called for every message fetched.
+	onGet func(id string)
+
+	gets    int
+	queries []string
+}
+
+func newFakeGmail() *fakeGmail {
+	return &fakeGmail{
+		messages: make(map[string]*gmail.Message),
+		pageSize: 2,
+		failing:  make(map[string]bool),
+	}
+}
+
+// add adds a message from sender to recipient on the given date.
+func (f *fakeGmail) add(id, from, to string, date time.Time, sent bool) {
+	msg := &gmail.Message{
+		Id: id,
+		Payload: &gmail.MessagePart{Headers: []*gmail.MessagePartHeader{
+			{Name: "From", Value: from},
+			{Name: "To", Value: to},
+			{Name: "Date", Value: date.Format(time.RFC1123Z)},
+			{Name: "Message-ID", Value: "<" + id + "@example.com>"},
+		}},
+	}
+	if sent {
+		msg.LabelIds = []string{"SENT"}
+	}
+	f.messages[id] = msg
+}
+
+func (f *fakeGmail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/")
+	switch {
+	case path == "profile":
+		writeJSON(w, &gmail.Profile{HistoryId: f.historyID})
+	case path == "history":
+		if f.expired {
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+			return
+		}
+		writeJSON(w, &gmail.ListHistoryResponse{History: f.history, HistoryId: f.historyID})
+	case path == "messages":
+		f.queries = append(f.queries, r.URL.Query().Get("q"))
+		ids := make([]string, 0, len(f.messages))
+		for id := range f.messages {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		end := min(start+f.pageSize, len(ids))
+		resp := &gmail.ListMessagesResponse{}
+		for _, id := range ids[start:end] {
+			resp.Messages = append(resp.Messages, &gmail.Message{Id: id})
+		}
+		if end < len(ids) {
+			resp.NextPageToken = strconv.Itoa(end)
+		}
+		writeJSON(w, resp)
+	case strings.HasPrefix(path, "messages/"):
+		id := strings.TrimPrefix(path, "messages/")
+		f.gets++
+		if f.onGet != nil {
+			f.onGet(id)
+		}
+		msg, ok := f.messages[id]
+		switch {
+		case f.failing[id]:
+			writeError(w, http.StatusBadRequest, "Invalid message.")
+		case !ok:
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		default:
+			writeJSON(w, msg)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":%q}}`, code, message)
+}
+
+// newTestEmailTool returns an EmailTool talking to f, with Ada and Grace as
+// contacts.
+func newTestEmailTool(t *testing.T, f *fakeGmail) *EmailTool {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	service, err := gmail.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("failed to create Gmail service: %v", err)
+	}
+	contacts := []config.Contact{
+		{Name: "Ada", Email: "ada@example.com", Priority: 1},
+		{Name: "Grace", Email: "grace@example.com", Priority: 2},
+	}
+	return &EmailTool{
+		service:     service,
+		identities:  config.NewIdentities(contacts, config.AddressOptions{}),
+		SyncHorizon: 365 * 24 * time.Hour,
+	}
+}
+
+func TestGetRecentInteractionsPages(t *testing.T) {
+	now := time.Now()
+	f := newFakeGmail()
+	f.add("m1", "Ada <ada@example.com>", "me@example.com", now.AddDate(0, 0, -3), false)
+	f.add("m2", "me@example.com", "ada@example.com", now.AddDate(0, 0, -2), true)
+	f.add("m3", "grace@example.com", "me@example.com", now.AddDate(0, 0, -1), false)
+	f.add("m4", "stranger@example.com", "me@example.com", now, false)
+	f.add("m5", "me@example.com", "Grace <grace@example.com>", now, true)
+
+	tool := newTestEmailTool(t, f)
+	ids, err := tool.listMessageIDs(context.Background(), "")
+	if err != nil {
+		t.Fatalf("listMessageIDs failed: %v", err)
+	}
+	if strings.Join(ids, ",") != "m1,m2,m3,m4,m5" {
+		t.Errorf("listMessageIDs = %v, want all five messages across three pages", ids)
+	}
+
+	interactions, err := tool.GetRecentInteractions(context.Background(), now.AddDate(0, 0, -7), "")
+	if err != nil {
+		t.Fatalf("GetRecentInteractions failed: %v", err)
+	}
+	got := make(map[string]string)
+	for _, interaction := range interactions {
+		got[interaction.Participant] = fmt.Sprintf("%d sent, %d received", interaction.SentCount, interaction.ReceivedCount)
+	}
+	want := map[string]string{
+		"ada@example.com":   "1 sent, 1 received",
+		"grace@example.com": "1 sent, 1 received",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("interactions = %v, want %v", got, want)
+	}
+}
+
+func TestGetRecentInteractionsSkipsDraftsSpamAndTrash(t *testing.T) {
+	now := time.Now()
+	f := newFakeGmail()
+	f.add("m1", "ada@example.com", "me@example.com", now.AddDate(0, 0, -3), false)
+	f.add("m2", "me@example.com", "ada@example.com", now.AddDate(0, 0, -2), true)
+	f.add("draft", "ada@example.com", "ada@example.com", now, false)
+	f.messages["draft"].LabelIds = []string{"DRAFT"}
+	f.add("spam", "ada@example.com", "me@example.com", now, false)
+	f.messages["spam"].LabelIds = []string{"SPAM"}
+	f.add("trash", "ada@example.com", "me@example.com", now, false)
+	f.messages["trash"].LabelIds = []string{"TRASH", "INBOX"}
+
+	tool := newTestEmailTool(t, f)
+	interactions, err := tool.GetRecentInteractions(context.Background(), now.AddDate(0, 0, -7), "")
+	if err != nil {
+		t.Fatalf("GetRecentInteractions failed: %v", err)
+	}
+	if len(interactions) != 1 {
+		t.Fatalf("interactions = %+v, want only Ada", interactions)
+	}
+	ada := interactions[0]
+	if ada.Count != 2 || ada.ReceivedCount != 1 || !ada.LastReceived.Equal(now.AddDate(0, 0, -3).Truncate(time.Second)) || ada.AwaitingReply() {
+		t.Errorf("Ada = %+v, want only m1 and m2 counted", ada)
+	}
+}
+
+func TestGetInteractionsByParticipantQueriesContact(t *testing.T) {
+	now := time.Now()
+	f := newFakeGmail()
+	f.add("m1", "ada@example.com", "me@example.com", now, false)
+
+	tool := newTestEmailTool(t, f)
+	since := now.AddDate(0, 0, -90)
+	if _, err := tool.GetInteractionsByParticipant(context.Background(), "Ada@Example.com", since); err != nil {
+		t.Fatalf("GetInteractionsByParticipant failed: %v", err)
+	}
+	want := "(from:ada@example.com OR to:ada@example.com) after:" + since.Format("2006/01/02")
+	if len(f.queries) != 1 || f.queries[0] != want {
+		t.Errorf("queries = %q, want %q", f.queries, want)
+	}
+}
+
+func TestGetLatestThreadSkipsDrafts(t *testing.T) {
+	f := newFakeGmail()
+	f.add("m1", "ada@example.com", "me@example.com", time.Now(), false)
+
+	tool := newTestEmailTool(t, f)
+	if _, err := tool.GetLatestThread(context.Background(), "ada@example.com"); err != nil {
+		t.Fatalf("GetLatestThread failed: %v", err)
+	}
+	if len(f.queries) != 1 || !strings.HasSuffix(f.queries[0], " -in:drafts -in:spam -in:trash") {
+		t.Errorf("queries = %q, want drafts, spam and trash excluded", f.queries)
+	}
+}
+
+func TestFetchMessagesReportsFailures(t *testing.T) {
+	now := time.Now()
+	f := newFakeGmail()
+	f.add("m1", "ada@example.com", "me@example.com", now, false)
+	f.add("m2", "ada@example.com", "me@example.com", now, false)
+	f.failing["m2"] = true
+
+	tool := newTestEmailTool(t, f)
+	messages, err := tool.fetchMessages(context.Background(), []string{"m1", "m2", "deleted"})
+	if err == nil || !strings.Contains(err.Error(), "failed to fetch 1 of 3 messages") {
+		t.Errorf("fetchMessages error = %v, want one failure", err)
+	}
+	if len(messages) != 1 || messages[0].ID != "m1" {
+		t.Errorf("fetchMessages = %+v, want only m1", messages)
+	}
+
+	// A message deleted since it was listed is not a failure.
+	messages, err = tool.fetchMessages(context.Background(), []string{"m1", "deleted"})
+	if err != nil || len(messages) != 1 {
+		t.Errorf("fetchMessages = %+v, %v; want m1 and no error", messages, err)
+	}
+}
+
+func TestFetchMessagesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := newFakeGmail()
+	var ids []string
+	for i := 0; i < 10*fetchWorkers; i++ {
+		id := fmt.Sprintf("m%03d", i)
+		f.add(id, "ada@example.com", "me@example.com", time.Now(), false)
+		ids = append(ids, id)
+	}
+	f.onGet = func(string) { cancel() }
+
+	tool := newTestEmailTool(t, f)
+	_, err := tool.fetchMessages(ctx, ids)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("fetchMessages error = %v, want context.Canceled", err)
+	}
+	if f.gets > 2*fetchWorkers {
+		t.Errorf("fetched %d messages after cancelling, want dispatch to stop", f.gets)
+	}
+}
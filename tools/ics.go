@@ -0,0 +1,304 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"socialbot/config"
+	"socialbot/retry"
+
+	"github.com/emersion/go-ical"
+	"github.com/golang/glog"
+	"github.com/teambition/rrule-go"
+)
+
+// ICSTool is a CalendarSource that reads iCalendar files from disk or from
+// published URLs, such as Outlook ICS publishing or iCloud calendar exports.
+type ICSTool struct {
+	// Sources lists .ics file paths and http(s) or webcal URLs.
+	Sources []string
+
+	// Me lists my own addresses, used to skip events I declined.
+	Me []string
+
+	client *http.Client
+}
+
+func NewICSTool(sources []string) *ICSTool {
+	return &ICSTool{
+		Sources: sources,
+		Me:      config.SplitList(os.Getenv("MY_EMAILS")),
+		client:  &http.Client{},
+	}
+}
+
+func (t *ICSTool) GetRecentEvents(ctx context.Context, since time.Time) ([]Event, error) {
+	return t.listEvents(ctx, since, time.Now())
+}
+
+func (t *ICSTool) GetUpcomingEvents(ctx context.Context, until time.Time) ([]Event, error) {
+	return t.listEvents(ctx, time.Now(), until)
+}
+
+func (t *ICSTool) listEvents(ctx context.Context, from, to time.Time) ([]Event, error) {
+	var result []Event
+	seen := make(map[string]bool)
+
+	for _, source := range t.Sources {
+		calendars, err := t.load(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+
+		before := len(result)
+		for _, cal := range calendars {
+			result = appendICSEvents(result, seen, cal, source, from, to, t.Me)
+		}
+		glog.Infof("Found %d events in %s between %s and %s", len(result)-before, source, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	sortEvents(result)
+	return result, nil
+}
+
+// load reads every VCALENDAR in source.
+func (t *ICSTool) load(ctx context.Context, source string) ([]*ical.Calendar, error) {
+	var r io.Reader
+	if url, ok := icsURL(source); ok {
+		data, err := t.fetch(ctx, url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %v", source, err)
+		}
+		r = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", source, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var calendars []*ical.Calendar
+	dec := ical.NewDecoder(r)
+	for {
+		cal, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", source, err)
+		}
+		calendars = append(calendars, cal)
+	}
+	return calendars, nil
+}
+
+// fetch downloads url.
+func (t *ICSTool) fetch(ctx context.Context, url string) ([]byte, error) {
+	var data []byte
+	err := retry.Do(ctx, "fetch "+url, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if err := retry.CheckResponse(resp); err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err = io.ReadAll(resp.Body)
+		return err
+	})
+	return data, err
+}
+
+// icsURL reports whether source is a URL rather than a file path, rewriting
+// webcal:// links to https://.
+func icsURL(source string) (string, bool) {
+	switch {
+	case strings.HasPrefix(source, "webcal://"):
+		return "https://" + strings.TrimPrefix(source, "webcal://"), true
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return source, true
+	}
+	return "", false
+}
+
+// appendICSEvents expands the events in cal into the instances overlapping
+// from..to and appends them to result. Recurring events are expanded from
+// their RRULE, RDATE and EXDATE properties, with instances replaced by any
+// RECURRENCE-ID overrides. Floating times and all-day dates are taken to be
+// local, matching Google Calendar. seen holds the UID and start of every
+// instance already added, so events shared between sources appear once.
+func appendICSEvents(result []Event, seen map[string]bool, cal *ical.Calendar, source string, from, to time.Time, me []string) []Event {
+	overridden := make(map[string]bool)
+	for _, item := range cal.Events() {
+		uid, _ := item.Props.Text(ical.PropUID)
+		if prop := item.Props.Get(ical.PropRecurrenceID); prop != nil {
+			if id, err := prop.DateTime(time.Local); err == nil {
+				overridden[instanceKey(uid, id)] = true
+			}
+		}
+	}
+
+	for _, item := range cal.Events() {
+		summary, _ := item.Props.Text(ical.PropSummary)
+		if status, _ := item.Status(); status == ical.EventCancelled {
+			glog.V(2).Infof("Skipping cancelled event '%s'", summary)
+			continue
+		}
+		if declinedICS(item, me) {
+			glog.V(2).Infof("Skipping declined event '%s'", summary)
+			continue
+		}
+
+		event, err := convertICSEvent(source, item)
+		if err != nil {
+			glog.Warningf("Skipping event '%s' in %s: %v", summary, source, err)
+			continue
+		}
+		uid, _ := item.Props.Text(ical.PropUID)
+		recurring := item.Props.Get(ical.PropRecurrenceRule) != nil
+
+		starts := []time.Time{event.StartTime}
+		if recurring {
+			set, err := recurrenceSet(item, event.StartTime)
+			if err != nil {
+				glog.Warningf("Skipping recurring event '%s' in %s: %v", summary, source, err)
+				continue
+			}
+			duration := event.EndTime.Sub(event.StartTime)
+			starts = set.Between(from.Add(-duration), to, true)
+		}
+
+		for _, start := range starts {
+			instance := event
+			instance.StartTime = start
+			instance.EndTime = start.Add(event.EndTime.Sub(event.StartTime))
+			if !instance.EndTime.After(from) || instance.StartTime.After(to) {
+				continue
+			}
+
+			key := instanceKey(uid, start)
+			if recurring && overridden[key] {
+				continue
+			}
+			if uid != "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+func instanceKey(uid string, start time.Time) string {
+	return uid + "/" + start.UTC().String()
+}
+
+func convertICSEvent(source string, item ical.Event) (Event, error) {
+	event := Event{Calendar: source}
+	event.Title, _ = item.Props.Text(ical.PropSummary)
+	event.Description, _ = item.Props.Text(ical.PropDescription)
+
+	start := item.Props.Get(ical.PropDateTimeStart)
+	if start == nil {
+		return event, fmt.Errorf("missing DTSTART")
+	}
+	event.AllDay = start.ValueType() == ical.ValueDate || len(start.Value) == len("20060102")
+
+	var err error
+	if event.StartTime, err = item.DateTimeStart(time.Local); err != nil {
+		return event, fmt.Errorf("invalid start: %v", err)
+	}
+	if event.EndTime, err = item.DateTimeEnd(time.Local); err != nil {
+		return event, fmt.Errorf("invalid end: %v", err)
+	}
+	if event.EndTime.IsZero() || event.EndTime.Before(event.StartTime) {
+		event.EndTime = event.StartTime
+	}
+
+	for _, attendee := range item.Props.Values(ical.PropAttendee) {
+		if address := icsAddress(attendee.Value); address != "" {
+			event.Attendees = append(event.Attendees, address)
+		}
+	}
+	return event, nil
+}
+
+// recurrenceSet builds the recurrence set of a recurring event starting at
+// start. EXDATE and RDATE may each hold a comma-separated list of dates.
+func recurrenceSet(item ical.Event, start time.Time) (*rrule.Set, error) {
+	option, err := item.Props.RecurrenceRule()
+	if err != nil {
+		return nil, err
+	}
+	option.Dtstart = start
+	rule, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRULE: %v", err)
+	}
+
+	set := &rrule.Set{}
+	set.RRule(rule)
+	for _, name := range []string{ical.PropExceptionDates, ical.PropRecurrenceDates} {
+		for _, prop := range item.Props.Values(name) {
+			for _, value := range strings.Split(prop.Value, ",") {
+				single := prop
+				single.Value = value
+				date, err := single.DateTime(time.Local)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %v", name, err)
+				}
+				if name == ical.PropExceptionDates {
+					set.ExDate(date)
+				} else {
+					set.RDate(date)
+				}
+			}
+		}
+	}
+	return set, nil
+}
+
+// declinedICS reports whether one of my addresses declined the event.
+func declinedICS(item ical.Event, me []string) bool {
+	for _, attendee := range item.Props.Values(ical.PropAttendee) {
+		if !strings.EqualFold(attendee.Params.Get(ical.ParamParticipationStatus), "DECLINED") {
+			continue
+		}
+		address := icsAddress(attendee.Value)
+		for _, mine := range me {
+			if strings.EqualFold(address, mine) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// icsAddress strips the mailto: scheme from a CAL-ADDRESS value.
+func icsAddress(value string) string {
+	if len(value) >= len("mailto:") && strings.EqualFold(value[:len("mailto:")], "mailto:") {
+		value = value[len("mailto:"):]
+	}
+	return strings.TrimSpace(value)
+}
+
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartTime.Before(events[j].StartTime)
+	})
+}
@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type eventSummary struct {
+	title string
+	start time.Time
+}
+
+func summarizeEvents(events []Event) []eventSummary {
+	var result []eventSummary
+	for _, event := range events {
+		result = append(result, eventSummary{event.Title, event.StartTime})
+	}
+	return result
+}
+
+// wantFixtureEvents is what testdata/calendar.ics holds for March 2024.
+func wantFixtureEvents(t *testing.T) []eventSummary {
+	t.Helper()
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	return []eventSummary{
+		{"Hiking trip", time.Date(2024, 3, 2, 0, 0, 0, 0, time.Local)},
+		{"Ada 1:1", time.Date(2024, 3, 4, 10, 0, 0, 0, ny)},
+		{"Dinner", time.Date(2024, 3, 15, 23, 0, 0, 0, time.UTC)},
+		{"Ada 1:1 (moved)", time.Date(2024, 3, 19, 11, 0, 0, 0, ny)},
+		{"Ada 1:1", time.Date(2024, 3, 25, 10, 0, 0, 0, ny)},
+	}
+}
+
+func checkEvents(t *testing.T, got []Event, want []eventSummary) {
+	t.Helper()
+	summary := summarizeEvents(got)
+	if len(summary) != len(want) {
+		t.Fatalf("got events %v, want %v", summary, want)
+	}
+	for i := range want {
+		if summary[i].title != want[i].title || !summary[i].start.Equal(want[i].start) {
+			t.Errorf("event %d = %v, want %v", i, summary[i], want[i])
+		}
+	}
+}
+
+func TestICSToolListEvents(t *testing.T) {
+	want := wantFixtureEvents(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/calendar.ics")
+	}))
+	defer srv.Close()
+
+	// The same calendar from a file and a URL should not produce duplicates.
+	tool := NewICSTool([]string{"testdata/calendar.ics", srv.URL + "/calendar.ics"})
+	tool.Me = []string{"me@example.com"}
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	events, err := tool.listEvents(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("listEvents failed: %v", err)
+	}
+	checkEvents(t, events, want)
+
+	hiking := events[0]
+	if !hiking.AllDay || !hiking.EndTime.Equal(hiking.StartTime.AddDate(0, 0, 1)) {
+		t.Errorf("hiking trip = %+v, want an all-day event lasting one day", hiking)
+	}
+	if got := events[1].Attendees; len(got) != 2 || got[1] != "ada@example.com" {
+		t.Errorf("1:1 attendees = %v", got)
+	}
+	if got := events[2].EndTime.Sub(events[2].StartTime); got != 2*time.Hour {
+		t.Errorf("dinner lasts %v, want 2h", got)
+	}
+}
+
+func TestICSToolDeclinedNeedsMe(t *testing.T) {
+	tool := NewICSTool([]string{"testdata/calendar.ics"})
+	tool.Me = nil
+
+	from := time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+	events, err := tool.listEvents(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("listEvents failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Title != "All hands" {
+		t.Errorf("got events %v, want only the all hands", summarizeEvents(events))
+	}
+}
+
+func TestICSToolMissingFile(t *testing.T) {
+	tool := NewICSTool([]string{"testdata/missing.ics"})
+	if _, err := tool.GetRecentEvents(context.Background(), time.Now().AddDate(0, 0, -1)); err == nil {
+		t.Error("GetRecentEvents succeeded for a missing file")
+	}
+}
@@ -0,0 +1,441 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"socialbot/config"
+	"socialbot/retry"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/golang/glog"
+)
+
+// envelopeBatch is how many envelopes are fetched with each UID FETCH, so
+// that no single command has to cover a whole folder.
+const envelopeBatch = 500
+
+// IMAPConfig describes how to reach an IMAP server and which folders hold
+// received, sent and draft mail.
+type IMAPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	TLS      bool
+
+	Inbox  string
+	Sent   string
+	Drafts string
+
+	// From is the address drafts are sent from. It defaults to Username.
+	From string
+}
+
+// IMAPConfigFromEnv reads the IMAP_* environment variables.
+func IMAPConfigFromEnv() IMAPConfig {
+	cfg := IMAPConfig{
+		Addr:     os.Getenv("IMAP_ADDR"),
+		Username: os.Getenv("IMAP_USERNAME"),
+		Password: os.Getenv("IMAP_PASSWORD"),
+		TLS:      os.Getenv("IMAP_TLS") != "false",
+		Inbox:    config.EnvOr("IMAP_INBOX", "INBOX"),
+		Sent:     config.EnvOr("IMAP_SENT_FOLDER", "Sent"),
+		Drafts:   config.EnvOr("IMAP_DRAFTS_FOLDER", "Drafts"),
+		From:     os.Getenv("IMAP_FROM"),
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.Username
+	}
+	return cfg
+}
+
+// IMAPTool is a MailSource that scans the inbox and sent folders of an IMAP
+// account and saves drafts with APPEND.
+type IMAPTool struct {
+	cfg        IMAPConfig
+	identities *config.Identities
+
+	// Archive holds messages imported from mbox or Maildir archives, which
+	// are merged with the messages found on the server.
+	Archive []Message
+}
+
+// NewIMAPTool returns an IMAPTool for cfg, matching addresses to contacts
+// through identities.
+func NewIMAPTool(cfg IMAPConfig, identities *config.Identities) *IMAPTool {
+	return &IMAPTool{
+		cfg:        cfg,
+		identities: identities,
+	}
+}
+
+// imapPolicy is retry.Default without its deadline on each attempt. IMAP
+// applies that deadline to each command instead, so a scan made of many
+// commands isn't cut off part way through a large mailbox.
+func imapPolicy() retry.Policy {
+	p := retry.Default
+	p.Timeout = 0
+	return p
+}
+
+// session connects to the server and runs fn, logging out afterwards. If
+// ctx is done first the connection is closed, aborting the command in
+// progress, and ctx's error is returned.
+func (t *IMAPTool) session(ctx context.Context, fn func(c *client.Client) error) error {
+	c, err := t.dial(ctx)
+	if err == nil {
+		defer c.Logout()
+		err = fn(c)
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (t *IMAPTool) dial(ctx context.Context) (*client.Client, error) {
+	if t.cfg.Addr == "" {
+		return nil, fmt.Errorf("IMAP_ADDR is not set")
+	}
+
+	var c *client.Client
+	var err error
+	dialer := contextDialer{ctx: ctx, timeout: retry.Default.Timeout}
+	if t.cfg.TLS {
+		c, err = client.DialWithDialerTLS(dialer, t.cfg.Addr, &tls.Config{})
+	} else {
+		c, err = client.DialWithDialer(dialer, t.cfg.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", t.cfg.Addr, err)
+	}
+	c.Timeout = dialer.timeout
+
+	if err := c.Login(t.cfg.Username, t.cfg.Password); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("failed to log in to %s: %v", t.cfg.Addr, err)
+	}
+	return c, nil
+}
+
+// contextDialer dials connections that are closed once ctx is done. If
+// timeout is set, it also bounds connecting and waiting for the greeting.
+type contextDialer struct {
+	ctx     context.Context
+	timeout time.Duration
+}
+
+func (d contextDialer) Dial(network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: d.timeout}
+	conn, err := dialer.DialContext(d.ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.timeout))
+	}
+	return &contextConn{Conn: conn, stop: context.AfterFunc(d.ctx, func() { conn.Close() })}, nil
+}
+
+type contextConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *contextConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// GetInteractionsByParticipant only fetches messages whose From, To, Cc or
+// Bcc header contains one of participant's addresses.
+func (t *IMAPTool) GetInteractionsByParticipant(ctx context.Context, participant string, since time.Time) ([]EmailInteraction, error) {
+	messages, err := t.scanAll(ctx, since, t.identities.AddressesFor(participant))
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeInteractions(FilterMessages(messages, since, participant, t.identities), t.identities), nil
+}
+
+// GetRecentInteractions scans the inbox and sent folders. IMAP has no
+// equivalent of Gmail's search syntax, so query is ignored.
+func (t *IMAPTool) GetRecentInteractions(ctx context.Context, since time.Time, query string) ([]EmailInteraction, error) {
+	if query != "" {
+		glog.V(1).Infof("Ignoring Gmail query %q for IMAP backend", query)
+	}
+
+	messages, err := t.scanAll(ctx, since, nil)
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeInteractions(messages, t.identities), nil
+}
+
+// scanAll returns the messages in the inbox and sent folders since the
+// given time, merged with archived ones. If addresses is not empty only
+// messages involving one of them are fetched from the server. Each folder
+// is scanned, and retried, on its own.
+func (t *IMAPTool) scanAll(ctx context.Context, since time.Time, addresses []string) ([]Message, error) {
+	var messages []Message
+	for _, folder := range []struct {
+		name string
+		sent bool
+	}{{t.cfg.Inbox, false}, {t.cfg.Sent, true}} {
+		var found []Message
+		err := imapPolicy().Do(ctx, "scan IMAP folder "+folder.name, func(ctx context.Context) error {
+			return t.session(ctx, func(c *client.Client) error {
+				var err error
+				found, err = scanFolder(c, folder.name, folder.sent, since, addresses)
+				return err
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, found...)
+	}
+	return MergeMessages(messages, FilterMessages(t.Archive, since, "", t.identities)), nil
+}
+
+func scanFolder(c *client.Client, folder string, sent bool, since time.Time, addresses []string) ([]Message, error) {
+	envelopes, err := fetchEnvelopes(c, folder, since, addresses)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(envelopes))
+	undated := 0
+	for _, msg := range envelopes {
+		if msg.Envelope.Date.IsZero() {
+			undated++
+		}
+		messages = append(messages, envelopeMessage(folder, msg, sent))
+	}
+	if undated > 0 {
+		glog.Warningf("%d messages in %s had a missing or unparseable Date header; used the internal date instead", undated, folder)
+	}
+	glog.Infof("Found %d messages in %s since %s", len(envelopes), folder, since.Format("2006-01-02"))
+	return messages, nil
+}
+
+// fetchEnvelopes returns the envelopes of every message in folder received
+// on or after since. If addresses is not empty, only messages with one of
+// them in a From, To, Cc or Bcc header are returned.
+func fetchEnvelopes(c *client.Client, folder string, since time.Time, addresses []string) ([]*imap.Message, error) {
+	if _, err := c.Select(folder, true); err != nil {
+		return nil, fmt.Errorf("failed to select %s: %v", folder, err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = since
+	if len(addresses) > 0 {
+		criteria.Or = append(criteria.Or, addressCriteria(addresses))
+	}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %v", folder, err)
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	var messages []*imap.Message
+	for start := 0; start < len(uids); start += envelopeBatch {
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(uids[start:min(start+envelopeBatch, len(uids))]...)
+
+		ch := make(chan *imap.Message, 16)
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchFlags, imap.FetchInternalDate}, ch)
+		}()
+
+		for msg := range ch {
+			if msg.Envelope != nil {
+				messages = append(messages, msg)
+			}
+		}
+		if err := <-done; err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %v", folder, err)
+		}
+	}
+	return messages, nil
+}
+
+// addressCriteria matches messages with any of addresses in a From, To, Cc
+// or Bcc header, as a tree of ORs.
+func addressCriteria(addresses []string) [2]*imap.SearchCriteria {
+	var terms []*imap.SearchCriteria
+	for _, address := range addresses {
+		for _, field := range []string{"From", "To", "Cc", "Bcc"} {
+			term := imap.NewSearchCriteria()
+			term.Header.Add(field, address)
+			terms = append(terms, term)
+		}
+	}
+	for len(terms) > 2 {
+		or := &imap.SearchCriteria{Or: [][2]*imap.SearchCriteria{{terms[0], terms[1]}}}
+		terms = append(terms[2:], or)
+	}
+	return [2]*imap.SearchCriteria{terms[0], terms[1]}
+}
+
+func envelopeMessage(folder string, msg *imap.Message, sent bool) Message {
+	m := Message{
+		ID:   fmt.Sprintf("%s:%d", folder, msg.Uid),
+		To:   imapAddresses(msg.Envelope.To),
+		Cc:   imapAddresses(msg.Envelope.Cc),
+		Bcc:  imapAddresses(msg.Envelope.Bcc),
+		Date: messageDate(msg),
+		Sent: sent,
+
+		MessageID: msg.Envelope.MessageId,
+	}
+	if from := imapAddresses(msg.Envelope.From); len(from) > 0 {
+		m.From = from[0]
+	}
+	for _, flag := range msg.Flags {
+		if flag == imap.DraftFlag {
+			m.Draft = true
+		}
+	}
+	return m
+}
+
+// messageDate returns the Date header, falling back to the server's internal
+// date when the header was missing or could not be parsed.
+func messageDate(msg *imap.Message) time.Time {
+	if msg.Envelope.Date.IsZero() {
+		return msg.InternalDate
+	}
+	return msg.Envelope.Date
+}
+
+func imapAddresses(addresses []*imap.Address) []string {
+	var result []string
+	for _, address := range addresses {
+		if address.MailboxName != "" && address.HostName != "" {
+			result = append(result, address.Address())
+		}
+	}
+	return result
+}
+
+// GetLatestThread finds the most recent message to or from participant in
+// the past year, skipping messages flagged as drafts. IMAP has no thread IDs, so the returned Thread only carries
+// the headers needed to reply to that message.
+func (t *IMAPTool) GetLatestThread(ctx context.Context, participant string) (*Thread, error) {
+	var thread *Thread
+	err := imapPolicy().Do(ctx, "find latest IMAP thread", func(ctx context.Context) error {
+		return t.session(ctx, func(c *client.Client) error {
+			var err error
+			thread, err = t.latestThread(c, participant)
+			return err
+		})
+	})
+	return thread, err
+}
+
+func (t *IMAPTool) latestThread(c *client.Client, participant string) (*Thread, error) {
+	since := time.Now().AddDate(-1, 0, 0)
+	var latest *imap.Message
+	var latestFolder string
+	for _, folder := range []string{t.cfg.Inbox, t.cfg.Sent} {
+		envelopes, err := fetchEnvelopes(c, folder, since, t.identities.AddressesFor(participant))
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range envelopes {
+			m := envelopeMessage(folder, msg, folder == t.cfg.Sent)
+			if m.Draft || !m.Involves(participant, t.identities) {
+				continue
+			}
+			if latest == nil || messageDate(msg).After(messageDate(latest)) {
+				latest, latestFolder = msg, folder
+			}
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	references, err := fetchReferences(c, latestFolder, latest.Uid)
+	if err != nil {
+		glog.Warningf("Failed to fetch References for %s:%d: %v", latestFolder, latest.Uid, err)
+	}
+
+	return &Thread{
+		Subject:    latest.Envelope.Subject,
+		MessageID:  latest.Envelope.MessageId,
+		References: references,
+		Date:       messageDate(latest),
+	}, nil
+}
+
+func fetchReferences(c *client.Client, folder string, uid uint32) (string, error) {
+	if _, err := c.Select(folder, true); err != nil {
+		return "", err
+	}
+
+	section := &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{
+			Specifier: imap.HeaderSpecifier,
+			Fields:    []string{"References"},
+		},
+		Peek: true,
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+
+	ch := make(chan *imap.Message, 1)
+	if err := c.UidFetch(seqset, []imap.FetchItem{section.FetchItem()}, ch); err != nil {
+		return "", err
+	}
+
+	msg := <-ch
+	if msg == nil {
+		return "", nil
+	}
+	body := msg.GetBody(section)
+	if body == nil {
+		return "", nil
+	}
+	header, err := textproto.NewReader(bufio.NewReader(body)).ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return "", nil
+	}
+	return strings.Join(strings.Fields(header.Get("References")), " "), nil
+}
+
+// SaveDraft appends the draft to the drafts folder with the \Draft flag.
+func (t *IMAPTool) SaveDraft(ctx context.Context, draft DraftEmail) error {
+	if draft.From == "" {
+		draft.From = t.cfg.From
+	}
+
+	now := time.Now()
+	message, err := BuildMessage(draft, now)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %v", err)
+	}
+
+	err = imapPolicy().DoWrite(ctx, "append IMAP draft", func(ctx context.Context) error {
+		return t.session(ctx, func(c *client.Client) error {
+			return c.Append(t.cfg.Drafts, []string{imap.DraftFlag, imap.SeenFlag}, now, bytes.NewReader(message))
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create draft: %v", err)
+	}
+
+	glog.Infof("Draft saved for %s in %s", draft.To, t.cfg.Drafts)
+	return nil
+}
@@ -0,0 +1,269 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"socialbot/config"
+	"socialbot/retry"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+)
+
+// startIMAPServer runs an in-memory IMAP server with empty Sent and Drafts
+// folders and returns a config pointing at it.
+func startIMAPServer(t *testing.T) IMAPConfig {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	cfg := IMAPConfig{
+		Addr:     l.Addr().String(),
+		Username: "username",
+		Password: "password",
+		Inbox:    "INBOX",
+		Sent:     "Sent",
+		Drafts:   "Drafts",
+		From:     "me@example.com",
+	}
+
+	c := dialTestServer(t, cfg)
+	defer c.Logout()
+	for _, folder := range []string{"Sent", "Drafts"} {
+		if err := c.Create(folder); err != nil {
+			t.Fatalf("failed to create %s: %v", folder, err)
+		}
+	}
+	return cfg
+}
+
+func dialTestServer(t *testing.T, cfg IMAPConfig) *client.Client {
+	t.Helper()
+	c, err := client.Dial(cfg.Addr)
+	if err != nil {
+		t.Fatalf("failed to dial test server: %v", err)
+	}
+	if err := c.Login(cfg.Username, cfg.Password); err != nil {
+		t.Fatalf("failed to log in to test server: %v", err)
+	}
+	return c
+}
+
+func appendTestMessage(t *testing.T, c *client.Client, folder string, date time.Time, headers string) {
+	t.Helper()
+	msg := strings.ReplaceAll(headers, "\n", "\r\n") + "Date: " + date.Format(time.RFC1123Z) + "\r\n\r\nHello\r\n"
+	if err := c.Append(folder, nil, date, bytes.NewBufferString(msg)); err != nil {
+		t.Fatalf("failed to append to %s: %v", folder, err)
+	}
+}
+
+func TestIMAPTool(t *testing.T) {
+	cfg := startIMAPServer(t)
+	now := time.Now().Truncate(time.Second)
+
+	c := dialTestServer(t, cfg)
+	appendTestMessage(t, c, "INBOX", now.AddDate(0, 0, -3),
+		"From: Ada <ada@example.com>\nTo: me@example.com\nSubject: Engine plans\nMessage-ID: <ada-1@example.com>\n")
+	appendTestMessage(t, c, "Sent", now.AddDate(0, 0, -1),
+		"From: me@example.com\nTo: Ada <ada@example.com>\nCc: grace@example.com\nSubject: Re: Engine plans\nMessage-ID: <me-1@example.com>\nReferences: <ada-1@example.com>\n")
+	c.Logout()
+
+	tool := NewIMAPTool(cfg, config.NewIdentities([]config.Contact{
+		{Email: "ada@example.com", Name: "Ada", Priority: 5},
+		{Email: "grace@example.com", Name: "Grace", Priority: 3},
+	}, config.AddressOptions{}))
+	ctx := context.Background()
+
+	interactions, err := tool.GetRecentInteractions(ctx, now.AddDate(0, 0, -30), "")
+	if err != nil {
+		t.Fatalf("GetRecentInteractions() error: %v", err)
+	}
+	if len(interactions) != 2 {
+		t.Fatalf("got %d interactions, want 2: %+v", len(interactions), interactions)
+	}
+	ada := interactions[0]
+	if ada.Participant != "ada@example.com" || ada.ReceivedCount != 1 || ada.SentCount != 1 || !ada.LastSent.Equal(now.AddDate(0, 0, -1)) {
+		t.Errorf("ada interaction = %+v, want one received and one sent", ada)
+	}
+	if grace := interactions[1]; grace.Participant != "grace@example.com" || grace.SentCount != 1 {
+		t.Errorf("grace interaction = %+v, want one sent via Cc", grace)
+	}
+
+	byParticipant, err := tool.GetInteractionsByParticipant(ctx, "ada@example.com", now.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("GetInteractionsByParticipant() error: %v", err)
+	}
+	if len(byParticipant) == 0 || byParticipant[0].Participant != "ada@example.com" || byParticipant[0].Count != 2 {
+		t.Errorf("GetInteractionsByParticipant() = %+v, want Ada's two messages", byParticipant)
+	}
+
+	// An unsent draft must not become the message the reply refers to.
+	c = dialTestServer(t, cfg)
+	draftMsg := "From: me@example.com\r\nTo: ada@example.com\r\nSubject: Unsent\r\nMessage-ID: <draft-1@example.com>\r\nDate: " + now.Format(time.RFC1123Z) + "\r\n\r\nHi\r\n"
+	if err := c.Append("Sent", []string{imap.DraftFlag}, now, bytes.NewBufferString(draftMsg)); err != nil {
+		t.Fatalf("failed to append draft: %v", err)
+	}
+	c.Logout()
+
+	thread, err := tool.GetLatestThread(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatalf("GetLatestThread() error: %v", err)
+	}
+	if thread == nil || thread.MessageID != "<me-1@example.com>" || thread.References != "<ada-1@example.com>" {
+		t.Fatalf("GetLatestThread() = %+v, want the sent reply", thread)
+	}
+
+	draft := DraftEmail{To: "ada@example.com", Subject: "Catching up", Body: "Hi Ada"}
+	draft.ReplyTo(*thread)
+	if err := tool.SaveDraft(ctx, draft); err != nil {
+		t.Fatalf("SaveDraft() error: %v", err)
+	}
+
+	c = dialTestServer(t, cfg)
+	defer c.Logout()
+	envelopes, err := fetchEnvelopes(c, "Drafts", now.AddDate(0, 0, -1), nil)
+	if err != nil {
+		t.Fatalf("failed to read Drafts: %v", err)
+	}
+	if len(envelopes) != 1 {
+		t.Fatalf("got %d drafts, want 1", len(envelopes))
+	}
+	saved := envelopes[0].Envelope
+	if saved.Subject != "Re: Engine plans" {
+		t.Errorf("draft subject = %q, want a reply subject", saved.Subject)
+	}
+	if saved.InReplyTo != "<me-1@example.com>" {
+		t.Errorf("draft In-Reply-To = %q, want <me-1@example.com>", saved.InReplyTo)
+	}
+	if from := imapAddresses(saved.From); len(from) != 1 || from[0] != "me@example.com" {
+		t.Errorf("draft From = %v, want me@example.com", from)
+	}
+
+	flags := make(chan *imap.Message, 1)
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(envelopes[0].Uid)
+	if err := c.UidFetch(seqset, []imap.FetchItem{imap.FetchFlags}, flags); err != nil {
+		t.Fatalf("failed to fetch draft flags: %v", err)
+	}
+	if msg := <-flags; msg == nil || !hasFlag(msg.Flags, imap.DraftFlag) {
+		t.Errorf("draft is missing the %s flag", imap.DraftFlag)
+	}
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// startSilentServer accepts connections but never greets the client, and
+// returns its address.
+func startSilentServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestIMAPToolHonorsContext(t *testing.T) {
+	tool := NewIMAPTool(IMAPConfig{Addr: startSilentServer(t), Inbox: "INBOX", Sent: "Sent"}, config.NewIdentities(nil, config.AddressOptions{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := tool.GetRecentInteractions(ctx, time.Now().AddDate(0, 0, -1), "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRecentInteractions error = %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetRecentInteractions took %v to notice the deadline", elapsed)
+	}
+}
+
+func TestFetchEnvelopesByAddress(t *testing.T) {
+	cfg := startIMAPServer(t)
+	now := time.Now()
+
+	c := dialTestServer(t, cfg)
+	defer c.Logout()
+	appendTestMessage(t, c, "INBOX", now, "From: Ada <ada@example.com>\nTo: me@example.com\nSubject: One\n")
+	appendTestMessage(t, c, "INBOX", now, "From: stranger@example.com\nTo: me@example.com\nSubject: Two\n")
+	appendTestMessage(t, c, "INBOX", now, "From: grace@example.com\nTo: me@example.com\nCc: ada@work.example.com\nSubject: Three\n")
+	appendTestMessage(t, c, "INBOX", now, "From: alan@example.com\nTo: me@example.com\nSubject: Four\n")
+
+	envelopes, err := fetchEnvelopes(c, "INBOX", now.AddDate(0, 0, -1), []string{"ada@example.com", "ada@work.example.com"})
+	if err != nil {
+		t.Fatalf("fetchEnvelopes() error: %v", err)
+	}
+	var subjects []string
+	for _, msg := range envelopes {
+		subjects = append(subjects, msg.Envelope.Subject)
+	}
+	if strings.Join(subjects, ",") != "One,Three" {
+		t.Errorf("fetched %v, want only the messages involving Ada", subjects)
+	}
+}
+
+func TestIMAPToolCommandTimeout(t *testing.T) {
+	defer func(p retry.Policy) { retry.Default = p }(retry.Default)
+	retry.Default = retry.Policy{MaxAttempts: 1, Timeout: 100 * time.Millisecond}
+
+	tool := NewIMAPTool(IMAPConfig{Addr: startSilentServer(t), Inbox: "INBOX", Sent: "Sent"}, config.NewIdentities(nil, config.AddressOptions{}))
+	start := time.Now()
+	if _, err := tool.GetRecentInteractions(context.Background(), time.Now().AddDate(0, 0, -1), ""); err == nil {
+		t.Error("GetRecentInteractions succeeded against a silent server")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetRecentInteractions took %v to time out", elapsed)
+	}
+}
+
+func TestFetchEnvelopesInBatches(t *testing.T) {
+	cfg := startIMAPServer(t)
+	now := time.Now()
+
+	c := dialTestServer(t, cfg)
+	defer c.Logout()
+	for i := 0; i < envelopeBatch+1; i++ {
+		appendTestMessage(t, c, "Sent", now, fmt.Sprintf("From: me@example.com\nTo: ada@example.com\nSubject: %d\n", i))
+	}
+
+	envelopes, err := fetchEnvelopes(c, "Sent", now.AddDate(0, 0, -1), nil)
+	if err != nil {
+		t.Fatalf("fetchEnvelopes() error: %v", err)
+	}
+	if len(envelopes) != envelopeBatch+1 {
+		t.Errorf("fetched %d envelopes, want %d", len(envelopes), envelopeBatch+1)
+	}
+}
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"sort"
+
+	"socialbot/config"
+
+	"github.com/golang/glog"
+)
+
+// MeetingWeight is how much a meeting with the given number of attendees
+// counts towards an interaction. A 1:1 counts fully; in larger meetings the
+// time is split between everyone else attending.
+func MeetingWeight(attendees int) float64 {
+	others := attendees - 1
+	if others <= 1 {
+		return 1
+	}
+	return 1 / float64(others)
+}
+
+// MergeMeetings attributes past calendar events to contacts and adds them to
+// interactions as meetings, creating interactions for contacts I have met
+// but not emailed.
+func MergeMeetings(interactions []EmailInteraction, events []Event, identities *config.Identities) []EmailInteraction {
+	byContact := make(map[string]*EmailInteraction)
+	for i := range interactions {
+		interaction := interactions[i]
+		byContact[interaction.Participant] = &interaction
+	}
+
+	for _, event := range events {
+		seen := make(map[string]bool)
+		for _, attendee := range event.Attendees {
+			contact := identities.Resolve(attendee)
+			if contact == nil || seen[contact.Email] {
+				continue
+			}
+			seen[contact.Email] = true
+
+			interaction, exists := byContact[contact.Email]
+			if !exists {
+				interaction = &EmailInteraction{
+					Participant: contact.Email,
+					Name:        contact.Name,
+					Priority:    contact.Priority,
+				}
+				byContact[contact.Email] = interaction
+			}
+
+			interaction.MeetingCount++
+			interaction.MeetingWeight += MeetingWeight(len(event.Attendees))
+			if len(event.Attendees) <= 2 {
+				interaction.OneOnOneCount++
+			}
+			if event.StartTime.After(interaction.LastMet) {
+				interaction.LastMet = event.StartTime
+			}
+			if event.StartTime.After(interaction.LastContact) {
+				interaction.LastContact = event.StartTime
+			}
+			glog.V(2).Infof("Event '%s' counted as a meeting with %s", event.Title, contact.Email)
+		}
+	}
+
+	result := make([]EmailInteraction, 0, len(byContact))
+	for _, interaction := range byContact {
+		result = append(result, *interaction)
+	}
+	sortInteractions(result)
+	return result
+}
+
+func sortInteractions(interactions []EmailInteraction) {
+	sort.Slice(interactions, func(i, j int) bool {
+		if interactions[i].Priority != interactions[j].Priority {
+			return interactions[i].Priority > interactions[j].Priority
+		}
+		return interactions[i].Participant < interactions[j].Participant
+	})
+}
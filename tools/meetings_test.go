@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"testing"
+	"time"
+
+	"socialbot/config"
+)
+
+func TestMergeMeetings(t *testing.T) {
+	identities := config.NewIdentities([]config.Contact{
+		{Name: "Ada", Email: "ada@example.com", Priority: 5},
+		{Name: "Grace", Email: "grace@example.com", Priority: 3, Aliases: []string{"grace@work.example.com"}},
+	}, config.AddressOptions{})
+
+	emailed := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	oneOnOne := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	standup := time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC)
+
+	interactions := []EmailInteraction{
+		{Participant: "ada@example.com", Name: "Ada", Priority: 5, LastContact: emailed, Count: 1},
+	}
+	events := []Event{
+		{Title: "1:1", StartTime: oneOnOne, Attendees: []string{"me@example.com", "Ada@Example.com"}},
+		{Title: "Standup", StartTime: standup, Attendees: []string{"me@example.com", "ada@example.com", "grace@work.example.com", "grace@example.com", "bob@example.com"}},
+		{Title: "Dentist", StartTime: standup},
+	}
+
+	got := MergeMeetings(interactions, events, identities)
+	if len(got) != 2 {
+		t.Fatalf("MergeMeetings returned %d interactions, want 2: %+v", len(got), got)
+	}
+
+	ada := got[0]
+	if ada.Participant != "ada@example.com" || ada.Count != 1 || ada.MeetingCount != 2 || ada.OneOnOneCount != 1 {
+		t.Errorf("ada = %+v", ada)
+	}
+	if want := 1 + MeetingWeight(5); ada.MeetingWeight != want {
+		t.Errorf("ada.MeetingWeight = %v, want %v", ada.MeetingWeight, want)
+	}
+	if !ada.LastMet.Equal(standup) || !ada.LastContact.Equal(standup) {
+		t.Errorf("ada.LastMet = %v, LastContact = %v, want %v", ada.LastMet, ada.LastContact, standup)
+	}
+
+	grace := got[1]
+	if grace.Participant != "grace@example.com" || grace.Name != "Grace" || grace.Count != 0 || grace.MeetingCount != 1 || grace.OneOnOneCount != 0 {
+		t.Errorf("grace = %+v", grace)
+	}
+}
+
+func TestMeetingWeight(t *testing.T) {
+	for _, tt := range []struct {
+		attendees int
+		want      float64
+	}{
+		{0, 1},
+		{1, 1},
+		{2, 1},
+		{3, 0.5},
+		{11, 0.1},
+	} {
+		if got := MeetingWeight(tt.attendees); got != tt.want {
+			t.Errorf("MeetingWeight(%d) = %v, want %v", tt.attendees, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+)
+
+// Attachment is a file attached to a draft.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// NewAttachment builds an attachment, guessing its content type from the
+// filename extension.
+func NewAttachment(path string, data []byte) Attachment {
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return Attachment{
+		Filename:    filepath.Base(path),
+		ContentType: contentType,
+		Data:        data,
+	}
+}
+
+// BuildMessage renders the draft as an RFC 5322 message with CRLF line
+// endings. The body is sent as multipart/alternative with a plain text part
+// and an HTML part rendered from Markdown, wrapped in multipart/mixed when
+// the draft has attachments.
+func BuildMessage(draft DraftEmail, date time.Time) ([]byte, error) {
+	var msg bytes.Buffer
+
+	headers := [][2]string{}
+	if draft.From != "" {
+		headers = append(headers, [2]string{"From", formatAddressList([]string{draft.From})})
+	}
+	headers = append(headers, [2]string{"To", formatAddressList([]string{draft.To})})
+	if len(draft.Cc) > 0 {
+		headers = append(headers, [2]string{"Cc", formatAddressList(draft.Cc)})
+	}
+	if len(draft.Bcc) > 0 {
+		headers = append(headers, [2]string{"Bcc", formatAddressList(draft.Bcc)})
+	}
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", draft.Subject)},
+		[2]string{"Date", date.Format(time.RFC1123Z)},
+	)
+	if draft.InReplyTo != "" {
+		headers = append(headers, [2]string{"In-Reply-To", draft.InReplyTo})
+	}
+	if draft.References != "" {
+		headers = append(headers, [2]string{"References", draft.References})
+	}
+	headers = append(headers, [2]string{"MIME-Version", "1.0"})
+
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+
+	body, contentType, err := buildBody(draft)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n\r\n", contentType)
+	msg.Write(body)
+
+	return msg.Bytes(), nil
+}
+
+func buildBody(draft DraftEmail) ([]byte, string, error) {
+	alternative, altType, err := buildAlternative(draft.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(draft.Attachments) == 0 {
+		return alternative, altType, nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {altType}})
+	if err != nil {
+		return nil, "", err
+	}
+	part.Write(alternative)
+
+	for _, attachment := range draft.Attachments {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Filename}))
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+		header.Set("Content-Transfer-Encoding", "base64")
+
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		writeBase64Lines(part, attachment.Data)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "multipart/mixed; boundary=" + w.Boundary(), nil
+}
+
+func buildAlternative(body string) ([]byte, string, error) {
+	var html bytes.Buffer
+	if err := goldmark.Convert([]byte(body), &html); err != nil {
+		return nil, "", fmt.Errorf("failed to render HTML body: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", body},
+		{"text/html; charset=UTF-8", html.String()},
+	}
+	for _, p := range parts {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		qp := quotedprintable.NewWriter(part)
+		qp.Write([]byte(toCRLF(p.content)))
+		qp.Close()
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "multipart/alternative; boundary=" + w.Boundary(), nil
+}
+
+// formatAddressList encodes display names with RFC 2047 where needed.
+// Addresses that cannot be parsed are passed through unchanged.
+func formatAddressList(addresses []string) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if parsed, err := mail.ParseAddress(address); err == nil {
+			formatted = append(formatted, parsed.String())
+		} else {
+			formatted = append(formatted, address)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func toCRLF(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
+
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
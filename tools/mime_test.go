@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	draft := DraftEmail{
+		Subject: "Café plans ☕",
+		Body:    "Hi **Zoë**,\n\nCoffee next week?",
+		To:      `"Zoë Example" <zoe@example.com>`,
+		Cc:      []string{"cc@example.com"},
+		Attachments: []Attachment{
+			NewAttachment("/tmp/notes.txt", []byte("some notes")),
+		},
+	}
+
+	raw, err := BuildMessage(draft, time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("BuildMessage() error: %v", err)
+	}
+	if bytes.Contains(bytes.ReplaceAll(raw, []byte("\r\n"), nil), []byte("\n")) {
+		t.Error("message contains bare LF line endings")
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse built message: %v", err)
+	}
+
+	rawSubject := msg.Header.Get("Subject")
+	if !strings.HasPrefix(rawSubject, "=?utf-8?q?") {
+		t.Errorf("Subject header %q is not RFC 2047 encoded", rawSubject)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(rawSubject); subject != draft.Subject {
+		t.Errorf("decoded Subject = %q, want %q", subject, draft.Subject)
+	}
+
+	to, err := msg.Header.AddressList("To")
+	if err != nil || len(to) != 1 || to[0].Name != "Zoë Example" || to[0].Address != "zoe@example.com" {
+		t.Errorf("To = %v (%v), want Zoë Example <zoe@example.com>", to, err)
+	}
+	if got := msg.Header.Get("Cc"); got != "<cc@example.com>" {
+		t.Errorf("Cc = %q, want <cc@example.com>", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/mixed", mediaType, err)
+	}
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	alternative, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read alternative part: %v", err)
+	}
+	altType, altParams, _ := mime.ParseMediaType(alternative.Header.Get("Content-Type"))
+	if altType != "multipart/alternative" {
+		t.Fatalf("first part is %q, want multipart/alternative", altType)
+	}
+
+	bodies := multipart.NewReader(alternative, altParams["boundary"])
+	var got []string
+	for {
+		part, err := bodies.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read body part: %v", err)
+		}
+		content, _ := io.ReadAll(part)
+		got = append(got, part.Header.Get("Content-Type")+"\n"+string(content))
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d body parts, want plain and HTML", len(got))
+	}
+	if !strings.HasPrefix(got[0], "text/plain") || !strings.Contains(got[0], "Hi **Zoë**,\r\n\r\nCoffee next week?") {
+		t.Errorf("plain part = %q", got[0])
+	}
+	if !strings.HasPrefix(got[1], "text/html") || !strings.Contains(got[1], "<strong>Zoë</strong>") {
+		t.Errorf("HTML part = %q", got[1])
+	}
+
+	attachment, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read attachment part: %v", err)
+	}
+	if attachment.FileName() != "notes.txt" {
+		t.Errorf("attachment filename = %q, want notes.txt", attachment.FileName())
+	}
+	if enc := attachment.Header.Get("Content-Transfer-Encoding"); enc != "base64" {
+		t.Errorf("attachment Content-Transfer-Encoding = %q, want base64", enc)
+	}
+	content, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	if string(content) != "some notes" {
+		t.Errorf("attachment content = %q, want %q", content, "some notes")
+	}
+}
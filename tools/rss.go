@@ -1,9 +1,13 @@
 package tools
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"socialbot/retry"
+
 	"github.com/mmcdole/gofeed"
 )
 
@@ -23,12 +27,21 @@ func NewRSSReader() *RSSReader {
 	}
 }
 
-func (r *RSSReader) GetRecentPosts(feedURL string, limit int) ([]BlogPost, error) {
+func (r *RSSReader) GetRecentPosts(ctx context.Context, feedURL string, limit int) ([]BlogPost, error) {
 	if feedURL == "" {
 		return nil, nil
 	}
 
-	feed, err := r.parser.ParseURL(feedURL)
+	var feed *gofeed.Feed
+	err := retry.Do(ctx, "fetch feed "+feedURL, func(ctx context.Context) error {
+		var err error
+		feed, err = r.parser.ParseURLWithContext(feedURL, ctx)
+		var httpErr gofeed.HTTPError
+		if errors.As(err, &httpErr) {
+			return &retry.StatusError{URL: feedURL, StatusCode: httpErr.StatusCode, Status: httpErr.Status}
+		}
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse feed: %v", err)
 	}
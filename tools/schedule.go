@@ -0,0 +1,247 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"socialbot/retry"
+
+	"github.com/golang/glog"
+	"google.golang.org/api/calendar/v3"
+)
+
+// TimeRange is the span of time from Start up to End.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (r TimeRange) Overlaps(other TimeRange) bool {
+	return r.Start.Before(other.End) && other.Start.Before(r.End)
+}
+
+// WorkingHours is the part of each weekday, Monday to Friday, when meetings
+// can be scheduled. Start and End are offsets from midnight.
+type WorkingHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+var DefaultWorkingHours = WorkingHours{Start: 9 * time.Hour, End: 17 * time.Hour}
+
+// ParseWorkingHours parses a range such as "09:00-17:30".
+func ParseWorkingHours(s string) (WorkingHours, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return WorkingHours{}, fmt.Errorf("invalid working hours %q: want HH:MM-HH:MM", s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return WorkingHours{}, fmt.Errorf("invalid working hours %q: %v", s, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return WorkingHours{}, fmt.Errorf("invalid working hours %q: %v", s, err)
+	}
+
+	hours := WorkingHours{
+		Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		End:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+	}
+	if hours.End <= hours.Start {
+		return WorkingHours{}, fmt.Errorf("invalid working hours %q: end must be after start", s)
+	}
+	return hours, nil
+}
+
+// WorkingHoursFromEnv reads WORKING_HOURS, defaulting to 09:00-17:00.
+func WorkingHoursFromEnv() WorkingHours {
+	value := os.Getenv("WORKING_HOURS")
+	if value == "" {
+		return DefaultWorkingHours
+	}
+	hours, err := ParseWorkingHours(value)
+	if err != nil {
+		glog.Warningf("Using default working hours: %v", err)
+		return DefaultWorkingHours
+	}
+	return hours
+}
+
+// Contains reports whether r falls on a weekday within working hours in loc.
+func (w WorkingHours) Contains(r TimeRange, loc *time.Location) bool {
+	start := r.Start.In(loc)
+	if start.Weekday() == time.Saturday || start.Weekday() == time.Sunday {
+		return false
+	}
+	day := func(offset time.Duration) time.Time {
+		return time.Date(start.Year(), start.Month(), start.Day(), 0, int(offset/time.Minute), 0, 0, loc)
+	}
+	return !start.Before(day(w.Start)) && !r.End.After(day(w.End))
+}
+
+// SlotOptions controls which slots ProposeSlots considers.
+type SlotOptions struct {
+	From     time.Time
+	To       time.Time
+	Duration time.Duration
+	Hours    WorkingHours
+
+	// Zones lists the time zone of everyone attending. The first is mine
+	// and decides which day a slot falls on.
+	Zones []*time.Location
+
+	Count int
+}
+
+// slotStep is how far apart candidate slot start times are.
+const slotStep = 30 * time.Minute
+
+// ProposeSlots returns up to opts.Count free slots between opts.From and
+// opts.To that fall within working hours in every zone. To spread the
+// choices out, at most one slot is proposed per day.
+func ProposeSlots(busy []TimeRange, opts SlotOptions) []TimeRange {
+	if len(opts.Zones) == 0 {
+		opts.Zones = []*time.Location{time.Local}
+	}
+
+	var slots []TimeRange
+	lastDay := ""
+	for start := opts.From.Truncate(slotStep); len(slots) < opts.Count; start = start.Add(slotStep) {
+		slot := TimeRange{Start: start, End: start.Add(opts.Duration)}
+		if slot.End.After(opts.To) {
+			break
+		}
+		if start.Before(opts.From) {
+			continue
+		}
+
+		day := start.In(opts.Zones[0]).Format("2006-01-02")
+		if day == lastDay || !free(slot, busy) {
+			continue
+		}
+		if !workingEverywhere(slot, opts.Hours, opts.Zones) {
+			continue
+		}
+
+		slots = append(slots, slot)
+		lastDay = day
+	}
+	return slots
+}
+
+func free(slot TimeRange, busy []TimeRange) bool {
+	for _, b := range busy {
+		if slot.Overlaps(b) {
+			return false
+		}
+	}
+	return true
+}
+
+func workingEverywhere(slot TimeRange, hours WorkingHours, zones []*time.Location) bool {
+	for _, loc := range zones {
+		if !hours.Contains(slot, loc) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hold is a tentative calendar event reserving time for a catch-up.
+type Hold struct {
+	Title       string
+	Description string
+	Slot        TimeRange
+
+	// Invite lists attendees to send an invitation to. With no attendees
+	// the hold only blocks my own calendar.
+	Invite []string
+}
+
+// NewSchedulingCalendarTool is like NewCalendarTool but also requests
+// permission to create events, which only the schedule command needs.
+func NewSchedulingCalendarTool() *CalendarTool {
+	return newCalendarTool(calendar.CalendarEventsScope)
+}
+
+// FreeBusy returns the times I am busy between from and to across every
+// configured calendar, sorted by start time.
+func (c *CalendarTool) FreeBusy(ctx context.Context, from, to time.Time) ([]TimeRange, error) {
+	req := &calendar.FreeBusyRequest{
+		TimeMin: from.Format(time.RFC3339),
+		TimeMax: to.Format(time.RFC3339),
+	}
+	for _, id := range c.CalendarIDs {
+		req.Items = append(req.Items, &calendar.FreeBusyRequestItem{Id: id})
+	}
+
+	var resp *calendar.FreeBusyResponse
+	err := retry.Do(ctx, "query free/busy", func(ctx context.Context) error {
+		var err error
+		resp, err = c.service.Freebusy.Query(req).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query free/busy: %v", err)
+	}
+
+	var busy []TimeRange
+	for id, cal := range resp.Calendars {
+		for _, e := range cal.Errors {
+			glog.Warningf("Free/busy unavailable for calendar %s: %s", id, e.Reason)
+		}
+		for _, period := range cal.Busy {
+			start, err := time.Parse(time.RFC3339, period.Start)
+			if err != nil {
+				return nil, fmt.Errorf("invalid busy period start %q: %v", period.Start, err)
+			}
+			end, err := time.Parse(time.RFC3339, period.End)
+			if err != nil {
+				return nil, fmt.Errorf("invalid busy period end %q: %v", period.End, err)
+			}
+			busy = append(busy, TimeRange{Start: start, End: end})
+		}
+	}
+	sort.Slice(busy, func(i, j int) bool {
+		return busy[i].Start.Before(busy[j].Start)
+	})
+	return busy, nil
+}
+
+// CreateHold adds a tentative event to my primary calendar, inviting any
+// attendees in hold.Invite, and returns a link to it.
+func (c *CalendarTool) CreateHold(ctx context.Context, hold Hold) (string, error) {
+	event := &calendar.Event{
+		Summary:     hold.Title,
+		Description: hold.Description,
+		Status:      "tentative",
+		Start:       &calendar.EventDateTime{DateTime: hold.Slot.Start.Format(time.RFC3339)},
+		End:         &calendar.EventDateTime{DateTime: hold.Slot.End.Format(time.RFC3339)},
+	}
+	for _, address := range hold.Invite {
+		event.Attendees = append(event.Attendees, &calendar.EventAttendee{Email: address})
+	}
+
+	sendUpdates := "none"
+	if len(hold.Invite) > 0 {
+		sendUpdates = "all"
+	}
+
+	var created *calendar.Event
+	err := retry.DoWrite(ctx, "create event", func(ctx context.Context) error {
+		var err error
+		created, err = c.service.Events.Insert("primary", event).SendUpdates(sendUpdates).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create event: %v", err)
+	}
+
+	glog.Infof("Created tentative event '%s' at %s", hold.Title, hold.Slot.Start.Format(time.RFC3339))
+	return created.HtmlLink, nil
+}
@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWorkingHours(t *testing.T) {
+	got, err := ParseWorkingHours("08:30 - 16:00")
+	if err != nil {
+		t.Fatalf("ParseWorkingHours failed: %v", err)
+	}
+	if want := (WorkingHours{Start: 8*time.Hour + 30*time.Minute, End: 16 * time.Hour}); got != want {
+		t.Errorf("ParseWorkingHours = %+v, want %+v", got, want)
+	}
+
+	for _, in := range []string{"9-5", "17:00-09:00", "09:00"} {
+		if _, err := ParseWorkingHours(in); err == nil {
+			t.Errorf("ParseWorkingHours(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestProposeSlots(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+
+	// Friday 2024-03-15 in UTC. Tokyo is UTC+9, so with 08:00-18:00 working
+	// hours in both zones only 08:00-09:00 UTC works for both.
+	from := time.Date(2024, 3, 15, 7, 10, 0, 0, time.UTC)
+	busy := []TimeRange{
+		{Start: time.Date(2024, 3, 15, 8, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 15, 8, 15, 0, 0, time.UTC)},
+	}
+	slots := ProposeSlots(busy, SlotOptions{
+		From:     from,
+		To:       from.AddDate(0, 0, 7),
+		Duration: 30 * time.Minute,
+		Hours:    WorkingHours{Start: 8 * time.Hour, End: 18 * time.Hour},
+		Zones:    []*time.Location{time.UTC, tokyo},
+		Count:    2,
+	})
+
+	want := []time.Time{
+		// Friday 08:00 overlaps the busy period, and only one slot is
+		// proposed per day, so the next is after the weekend.
+		time.Date(2024, 3, 15, 8, 30, 0, 0, time.UTC),
+		time.Date(2024, 3, 18, 8, 0, 0, 0, time.UTC),
+	}
+	if len(slots) != len(want) {
+		t.Fatalf("ProposeSlots returned %v, want starts %v", slots, want)
+	}
+	for i := range want {
+		if !slots[i].Start.Equal(want[i]) {
+			t.Errorf("slot %d starts at %v, want %v", i, slots[i].Start, want[i])
+		}
+	}
+}
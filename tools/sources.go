@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"context"
+	"time"
+)
+
+// MailSource summarizes email interactions with contacts and saves drafts.
+type MailSource interface {
+	GetRecentInteractions(ctx context.Context, since time.Time, query string) ([]EmailInteraction, error)
+	// GetInteractionsByParticipant summarizes mail since the given time with
+	// participant's contact, searching only their addresses where the backend
+	// can.
+	GetInteractionsByParticipant(ctx context.Context, participant string, since time.Time) ([]EmailInteraction, error)
+	GetLatestThread(ctx context.Context, participant string) (*Thread, error)
+	SaveDraft(ctx context.Context, draft DraftEmail) error
+}
+
+// CalendarSource lists calendar events.
+type CalendarSource interface {
+	// GetRecentEvents returns events between since and now.
+	GetRecentEvents(ctx context.Context, since time.Time) ([]Event, error)
+	// GetUpcomingEvents returns events between now and until.
+	GetUpcomingEvents(ctx context.Context, until time.Time) ([]Event, error)
+}
+
+// FeedSource fetches blog posts from a contact's feed.
+type FeedSource interface {
+	GetRecentPosts(ctx context.Context, feedURL string, limit int) ([]BlogPost, error)
+}
+
+// Scheduler checks my availability and books time on my calendar.
+type Scheduler interface {
+	// FreeBusy returns the times I am busy between from and to.
+	FreeBusy(ctx context.Context, from, to time.Time) ([]TimeRange, error)
+	// CreateHold adds a tentative event and returns a link to it.
+	CreateHold(ctx context.Context, hold Hold) (string, error)
+}
+
+var (
+	_ MailSource     = (*EmailTool)(nil)
+	_ MailSource     = (*IMAPTool)(nil)
+	_ CalendarSource = (*CalendarTool)(nil)
+	_ CalendarSource = (*ICSTool)(nil)
+	_ CalendarSource = (*CalDAVTool)(nil)
+	_ Scheduler      = (*CalendarTool)(nil)
+	_ FeedSource     = (*RSSReader)(nil)
+)
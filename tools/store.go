@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"socialbot/config"
+)
+
+// InteractionStore is a local cache of per-message interaction records kept
+// in sync with Gmail through the history API.
+type InteractionStore struct {
+	path string
+
+	// HistoryID is the Gmail history ID the store is up to date with, or 0
+	// if it has never been synced.
+	HistoryID uint64             `json:"history_id"`
+	Messages  map[string]Message `json:"messages"`
+
+	// Archive holds messages imported from mbox or Maildir archives. It is
+	// kept across full resyncs.
+	Archive map[string]Message `json:"archive,omitempty"`
+}
+
+// LoadInteractionStore reads the store at path, returning an empty store if
+// the file does not exist yet.
+func LoadInteractionStore(path string) (*InteractionStore, error) {
+	store := &InteractionStore{
+		path:     path,
+		Messages: make(map[string]Message),
+		Archive:  make(map[string]Message),
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read interaction store: %v", err)
+	}
+
+	if err := json.Unmarshal(b, store); err != nil {
+		return nil, fmt.Errorf("failed to parse interaction store %s: %v", path, err)
+	}
+	if store.Messages == nil {
+		store.Messages = make(map[string]Message)
+	}
+	if store.Archive == nil {
+		store.Archive = make(map[string]Message)
+	}
+	return store, nil
+}
+
+// Save writes the store back to disk, replacing the previous file atomically.
+func (s *InteractionStore) Save() error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode interaction store: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save interaction store: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save interaction store: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save interaction store: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save interaction store: %v", err)
+	}
+	return nil
+}
+
+// Reset discards every synced message ahead of a full resync. Archived
+// messages are kept.
+func (s *InteractionStore) Reset() {
+	s.HistoryID = 0
+	s.Messages = make(map[string]Message)
+}
+
+func (s *InteractionStore) Put(msg Message) {
+	s.Messages[msg.ID] = msg
+}
+
+func (s *InteractionStore) Delete(id string) {
+	delete(s.Messages, id)
+}
+
+// Import adds archived messages to the store, returning how many were new.
+func (s *InteractionStore) Import(messages []Message) int {
+	added := 0
+	for _, msg := range messages {
+		if _, exists := s.Archive[msg.ID]; !exists {
+			added++
+		}
+		s.Archive[msg.ID] = msg
+	}
+	return added
+}
+
+// All returns every synced and archived message, oldest first.
+func (s *InteractionStore) All() []Message {
+	return MergeMessages(mapValues(s.Messages), mapValues(s.Archive))
+}
+
+// ArchivedMessages returns every archived message, oldest first.
+func (s *InteractionStore) ArchivedMessages() []Message {
+	return MergeMessages(nil, mapValues(s.Archive))
+}
+
+func mapValues(m map[string]Message) []Message {
+	messages := make([]Message, 0, len(m))
+	for _, msg := range m {
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// MergeMessages combines live and archived messages, dropping archived
+// messages whose Message-ID is already present in live, and sorts the
+// result oldest first.
+func MergeMessages(live, archived []Message) []Message {
+	seen := make(map[string]bool)
+	messages := make([]Message, 0, len(live)+len(archived))
+	for _, msg := range live {
+		if msg.MessageID != "" {
+			seen[msg.MessageID] = true
+		}
+		messages = append(messages, msg)
+	}
+	for _, msg := range archived {
+		if msg.MessageID != "" && seen[msg.MessageID] {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].Date.Equal(messages[j].Date) {
+			return messages[i].Date.Before(messages[j].Date)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+	return messages
+}
+
+// FilterMessages returns the messages dated on or after since that involve
+// participant or any of their aliases. An empty participant matches every
+// message.
+func FilterMessages(messages []Message, since time.Time, participant string, identities *config.Identities) []Message {
+	var filtered []Message
+	for _, msg := range messages {
+		if msg.Date.Before(since) {
+			continue
+		}
+		if participant != "" && !msg.Involves(participant, identities) {
+			continue
+		}
+		filtered = append(filtered, msg)
+	}
+	return filtered
+}
+
+// Involves reports whether participant, or another address of the same
+// contact, took part in the message.
+func (m Message) Involves(participant string, identities *config.Identities) bool {
+	for _, p := range m.Participants() {
+		if identities.Same(p, participant) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInteractionStoreLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "interactions.json")
+
+	store, err := LoadInteractionStore(path)
+	if err != nil {
+		t.Fatalf("LoadInteractionStore of a missing file failed: %v", err)
+	}
+	if store.HistoryID != 0 || len(store.Messages) != 0 || len(store.Archive) != 0 {
+		t.Fatalf("new store = %+v, want an empty store", store)
+	}
+
+	date := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	store.HistoryID = 42
+	store.Put(Message{ID: "m1", From: "ada@example.com", Date: date, MessageID: "<m1@example.com>"})
+	store.Put(Message{ID: "m2", To: []string{"ada@example.com"}, Date: date.Add(time.Hour), Sent: true})
+	store.Delete("m2")
+	store.Import([]Message{{ID: "a1", From: "grace@example.com", Date: date.AddDate(-1, 0, 0)}})
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadInteractionStore(path)
+	if err != nil {
+		t.Fatalf("LoadInteractionStore failed: %v", err)
+	}
+	if loaded.HistoryID != 42 || storedIDs(loaded) != "m1" || len(loaded.Archive) != 1 {
+		t.Fatalf("loaded store: history ID %d, messages %s, archive %v", loaded.HistoryID, storedIDs(loaded), loaded.Archive)
+	}
+	if msg := loaded.Messages["m1"]; !msg.Date.Equal(date) || msg.MessageID != "<m1@example.com>" {
+		t.Errorf("loaded message = %+v", msg)
+	}
+	if all := loaded.All(); len(all) != 2 || all[0].ID != "a1" {
+		t.Errorf("All() = %+v, want the archived message first", all)
+	}
+
+	loaded.Reset()
+	if loaded.HistoryID != 0 || len(loaded.Messages) != 0 || len(loaded.Archive) != 1 {
+		t.Errorf("after Reset: %+v, want archived messages kept", loaded)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadInteractionStore(path); err == nil {
+		t.Error("LoadInteractionStore of a corrupt file succeeded")
+	}
+}
@@ -0,0 +1,164 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"socialbot/retry"
+
+	"github.com/golang/glog"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Sync brings the store up to date with the mailbox. The first sync, or one
+// whose saved history ID has expired, lists every message within
+// SyncHorizon; later syncs only fetch changes since the saved history ID.
+func (e *EmailTool) Sync(ctx context.Context, store *InteractionStore) error {
+	if store.HistoryID != 0 {
+		err := e.incrementalSync(ctx, store)
+		if err == nil || !isHistoryExpired(err) {
+			return err
+		}
+		glog.Warningf("History ID %d has expired, falling back to a full resync", store.HistoryID)
+	}
+	return e.fullSync(ctx, store)
+}
+
+func (e *EmailTool) fullSync(ctx context.Context, store *InteractionStore) error {
+	// Read the history ID before listing so changes made during the sync are
+	// picked up by the next incremental sync.
+	var profile *gmail.Profile
+	err := retry.Do(ctx, "get profile", func(ctx context.Context) error {
+		var err error
+		profile, err = e.service.Users.GetProfile("me").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get mailbox profile: %v", err)
+	}
+
+	since := time.Now().Add(-e.SyncHorizon)
+	query := fmt.Sprintf("after:%s", since.Format("2006/01/02"))
+	glog.Infof("Running full mail sync with: %s", query)
+
+	ids, err := e.listMessageIDs(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	// Only replace the stored messages once all of them have been fetched.
+	messages, err := e.fetchMessages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	store.Reset()
+	for _, msg := range messages {
+		if msg.Exchanged() {
+			store.Put(msg)
+		}
+	}
+	store.HistoryID = profile.HistoryId
+
+	glog.Infof("Full sync stored %d messages at history ID %d", len(store.Messages), store.HistoryID)
+	return store.Save()
+}
+
+func (e *EmailTool) incrementalSync(ctx context.Context, store *InteractionStore) error {
+	added := make(map[string]bool)
+	var deleted []string
+	historyID := store.HistoryID
+	pageToken := ""
+
+	for {
+		call := e.service.Users.History.
+			List("me").
+			StartHistoryId(store.HistoryID).
+			HistoryTypes("messageAdded", "messageDeleted", "labelAdded", "labelRemoved")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var page *gmail.ListHistoryResponse
+		err := retry.Do(ctx, "list history", func(ctx context.Context) error {
+			var err error
+			page, err = call.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, h := range page.History {
+			for _, m := range h.MessagesAdded {
+				added[m.Message.Id] = true
+			}
+			for _, m := range h.MessagesDeleted {
+				delete(added, m.Message.Id)
+				deleted = append(deleted, m.Message.Id)
+			}
+			// Moving a message to or from the trash or spam changes whether
+			// a full sync would store it.
+			for _, m := range h.LabelsAdded {
+				if hidesMessage(m.LabelIds) {
+					delete(added, m.Message.Id)
+					deleted = append(deleted, m.Message.Id)
+				}
+			}
+			for _, m := range h.LabelsRemoved {
+				if hidesMessage(m.LabelIds) {
+					added[m.Message.Id] = true
+				}
+			}
+		}
+		historyID = page.HistoryId
+
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	ids := make([]string, 0, len(added))
+	for id := range added {
+		ids = append(ids, id)
+	}
+
+	// Leave the store untouched unless every change can be applied, so a
+	// failed sync is retried from the same history ID.
+	messages, err := e.fetchMessages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range deleted {
+		store.Delete(id)
+	}
+	for _, msg := range messages {
+		if msg.Exchanged() {
+			store.Put(msg)
+		} else {
+			store.Delete(msg.ID)
+		}
+	}
+	store.HistoryID = historyID
+
+	glog.Infof("Incremental sync added %d and removed %d messages, now at history ID %d", len(ids), len(deleted), historyID)
+	return store.Save()
+}
+
+// hidesMessage reports whether labels include TRASH or SPAM, which full
+// syncs leave out.
+func hidesMessage(labels []string) bool {
+	for _, label := range labels {
+		if label == "TRASH" || label == "SPAM" {
+			return true
+		}
+	}
+	return false
+}
+
+// isHistoryExpired reports whether Gmail rejected a history request because
+// the start history ID is too old.
+func isHistoryExpired(err error) bool {
+	return isNotFound(err)
+}
@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func storedIDs(store *InteractionStore) string {
+	var ids []string
+	for id := range store.Messages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func loadTestStore(t *testing.T, path string) *InteractionStore {
+	t.Helper()
+	store, err := LoadInteractionStore(path)
+	if err != nil {
+		t.Fatalf("LoadInteractionStore failed: %v", err)
+	}
+	return store
+}
+
+func TestSyncFullThenIncremental(t *testing.T) {
+	now := time.Now()
+	f := newFakeGmail()
+	f.historyID = 100
+	f.add("m1", "ada@example.com", "me@example.com", now.AddDate(0, 0, -2), false)
+	f.add("m2", "me@example.com", "ada@example.com", now.AddDate(0, 0, -1), true)
+	f.add("m3", "grace@example.com", "me@example.com", now, false)
+
+	tool := newTestEmailTool(t, f)
+	path := filepath.Join(t.TempDir(), "interactions.json")
+	store := loadTestStore(t, path)
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("first Sync failed: %v", err)
+	}
+	store = loadTestStore(t, path)
+	if store.HistoryID != 100 || storedIDs(store) != "m1,m2,m3" {
+		t.Fatalf("after full sync: history ID %d, messages %s", store.HistoryID, storedIDs(store))
+	}
+
+	f.add("m4", "ada@example.com", "me@example.com", now, false)
+	f.historyID = 110
+	f.history = []*gmail.History{
+		{MessagesAdded: []*gmail.HistoryMessageAdded{{Message: &gmail.Message{Id: "m4"}}}},
+		{MessagesDeleted: []*gmail.HistoryMessageDeleted{{Message: &gmail.Message{Id: "m1"}}}},
+	}
+	gets := f.gets
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("incremental Sync failed: %v", err)
+	}
+	store = loadTestStore(t, path)
+	if store.HistoryID != 110 || storedIDs(store) != "m2,m3,m4" {
+		t.Errorf("after incremental sync: history ID %d, messages %s", store.HistoryID, storedIDs(store))
+	}
+	if f.gets-gets != 1 {
+		t.Errorf("incremental sync fetched %d messages, want only the new one", f.gets-gets)
+	}
+}
+
+func TestSyncFallsBackWhenHistoryExpired(t *testing.T) {
+	f := newFakeGmail()
+	f.historyID = 200
+	f.expired = true
+	f.add("m1", "ada@example.com", "me@example.com", time.Now(), false)
+
+	tool := newTestEmailTool(t, f)
+	store := loadTestStore(t, filepath.Join(t.TempDir(), "interactions.json"))
+	store.HistoryID = 50
+	store.Put(Message{ID: "gone", From: "ada@example.com", Date: time.Now()})
+	store.Import([]Message{{ID: "archived", From: "grace@example.com", Date: time.Now()}})
+
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if store.HistoryID != 200 || storedIDs(store) != "m1" {
+		t.Errorf("after resync: history ID %d, messages %s; want 200 and m1", store.HistoryID, storedIDs(store))
+	}
+	if len(store.Archive) != 1 {
+		t.Errorf("resync dropped archived messages: %v", store.Archive)
+	}
+}
+
+func TestFailedSyncKeepsStore(t *testing.T) {
+	now := time.Now()
+	f := newFakeGmail()
+	f.historyID = 100
+	f.add("m1", "ada@example.com", "me@example.com", now, false)
+
+	tool := newTestEmailTool(t, f)
+	path := filepath.Join(t.TempDir(), "interactions.json")
+	store := loadTestStore(t, path)
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("first Sync failed: %v", err)
+	}
+
+	// A message that can't be fetched must not be skipped by moving the
+	// history ID past it.
+	f.add("m2", "ada@example.com", "me@example.com", now, false)
+	f.failing["m2"] = true
+	f.historyID = 110
+	f.history = []*gmail.History{
+		{MessagesAdded: []*gmail.HistoryMessageAdded{{Message: &gmail.Message{Id: "m2"}}}},
+		{MessagesDeleted: []*gmail.HistoryMessageDeleted{{Message: &gmail.Message{Id: "m1"}}}},
+	}
+	if err := tool.Sync(context.Background(), store); err == nil {
+		t.Fatal("incremental Sync succeeded despite a failed message")
+	}
+	if store.HistoryID != 100 || storedIDs(store) != "m1" {
+		t.Errorf("after failed incremental sync: history ID %d, messages %s", store.HistoryID, storedIDs(store))
+	}
+
+	// Nor may a failed full sync throw away what was stored.
+	f.expired = true
+	if err := tool.Sync(context.Background(), store); err == nil {
+		t.Fatal("full Sync succeeded despite a failed message")
+	}
+	saved := loadTestStore(t, path)
+	if saved.HistoryID != 100 || storedIDs(saved) != "m1" || storedIDs(store) != "m1" {
+		t.Errorf("after failed full sync: history ID %d, messages %s", saved.HistoryID, storedIDs(saved))
+	}
+
+	f.failing["m2"] = false
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync failed after recovery: %v", err)
+	}
+	if store.HistoryID != 110 || storedIDs(store) != "m1,m2" {
+		t.Errorf("after recovery: history ID %d, messages %s", store.HistoryID, storedIDs(store))
+	}
+}
+
+func TestSyncSkipsDraftsSpamAndTrash(t *testing.T) {
+	now := time.Now()
+	f := newFakeGmail()
+	f.historyID = 100
+	f.add("m1", "ada@example.com", "me@example.com", now, false)
+	f.add("m2", "grace@example.com", "me@example.com", now, false)
+	f.add("d1", "me@example.com", "ada@example.com", now, false)
+	f.messages["d1"].LabelIds = []string{"DRAFT"}
+
+	tool := newTestEmailTool(t, f)
+	store := loadTestStore(t, filepath.Join(t.TempDir(), "interactions.json"))
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("first Sync failed: %v", err)
+	}
+	if storedIDs(store) != "m1,m2" {
+		t.Fatalf("after full sync: messages %s, want the draft left out", storedIDs(store))
+	}
+
+	// A new draft and spam are left out, and trashing a message removes it.
+	f.add("d2", "me@example.com", "grace@example.com", now, false)
+	f.messages["d2"].LabelIds = []string{"DRAFT"}
+	f.add("s1", "ada@example.com", "me@example.com", now, false)
+	f.messages["s1"].LabelIds = []string{"SPAM"}
+	f.messages["m1"].LabelIds = []string{"TRASH"}
+	f.historyID = 110
+	f.history = []*gmail.History{
+		{MessagesAdded: []*gmail.HistoryMessageAdded{{Message: &gmail.Message{Id: "d2"}}, {Message: &gmail.Message{Id: "s1"}}}},
+		{LabelsAdded: []*gmail.HistoryLabelAdded{{Message: &gmail.Message{Id: "m1"}, LabelIds: []string{"TRASH"}}}},
+	}
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("incremental Sync failed: %v", err)
+	}
+	if storedIDs(store) != "m2" {
+		t.Errorf("after trashing m1: messages %s, want m2", storedIDs(store))
+	}
+
+	// Taking it back out of the trash restores it.
+	f.messages["m1"].LabelIds = nil
+	f.historyID = 120
+	f.history = []*gmail.History{
+		{LabelsRemoved: []*gmail.HistoryLabelRemoved{{Message: &gmail.Message{Id: "m1"}, LabelIds: []string{"TRASH"}}}},
+	}
+	if err := tool.Sync(context.Background(), store); err != nil {
+		t.Fatalf("incremental Sync failed: %v", err)
+	}
+	if storedIDs(store) != "m1,m2" {
+		t.Errorf("after restoring m1: messages %s, want m1,m2", storedIDs(store))
+	}
+}